@@ -0,0 +1,41 @@
+package lirc
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrRemoteNotAllowed is returned when sending a command to a remote control
+// that isn't allowed by [WithAllowedRemotes].
+var ErrRemoteNotAllowed = errors.New("lirc: remote control not allowed")
+
+// sendingRemote returns the remote control that command transmits with, if
+// any.
+func sendingRemote(command Command) (string, bool) {
+	switch command := command.(type) {
+	case SendOnce:
+		return command.RemoteControl, true
+	case SendStart:
+		return command.RemoteControl, true
+	case SendStop:
+		return command.RemoteControl, true
+	default:
+		return "", false
+	}
+}
+
+// checkAllowedRemote returns an error if command transmits with a remote
+// control that isn't allowed.
+func (l *Connection) checkAllowedRemote(command Command) error {
+	if l.opts.allowedRemotes == nil {
+		return nil
+	}
+
+	remote, ok := sendingRemote(command)
+	if !ok || slices.Contains(l.opts.allowedRemotes, remote) {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %q", ErrRemoteNotAllowed, remote)
+}
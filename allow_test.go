@@ -0,0 +1,28 @@
+package lirc
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestAllowedRemotes(t *testing.T) {
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, []Option{WithAllowedRemotes("tv")})
+	ctx := startTestConnection(t, conn)
+
+	_, err := conn.SendCommand(ctx, SendOnce{RemoteControl: "tv", ButtonName: "KEY_POWER"})
+	assert.NoError(t, err, "allowed remote")
+
+	_, err = conn.SendCommand(ctx, SendOnce{RemoteControl: "garage", ButtonName: "KEY_OPEN"})
+	assert.IsError(t, err, ErrRemoteNotAllowed, "other remote")
+
+	_, err = conn.RepeatButton(ctx, "garage", "KEY_OPEN")
+	assert.IsError(t, err, ErrRemoteNotAllowed, "repeating with another remote")
+
+	_, err = conn.SendCommand(ctx, List{RemoteControl: "garage"})
+	assert.NoError(t, err, "commands that don't send are allowed")
+
+	assert.Equal(t, []string{"SEND_ONCE tv KEY_POWER", "LIST garage"}, srv.received(),
+		"rejected commands are never written")
+}
@@ -0,0 +1,130 @@
+package lirc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// ErrClosed is returned when sending a command on a connection that was
+// closed with [Connection.Close].
+var ErrClosed = errors.New("lirc: connection closed")
+
+// autoRun is a Start call made by [WithAutoStart].
+type autoRun struct {
+	cancel context.CancelFunc
+	done   chan struct{} // closed once Start returns
+	// err and connected are set before done is closed.
+	err       error
+	connected bool
+}
+
+// Close stops the connection started by [WithAutoStart] and waits for it to
+// shut down. Commands sent afterwards fail with [ErrClosed], as they do once
+// the context given to WithAutoStart is done. Close does nothing on
+// connections started with [Connection.Start].
+func (l *Connection) Close() error {
+	l.autoMu.Lock()
+	l.closed = true
+	run := l.autoRun
+	l.autoMu.Unlock()
+
+	if run == nil {
+		return nil
+	}
+
+	run.cancel()
+	<-run.done
+
+	if run.err != nil && !errors.Is(run.err, context.Canceled) && !errors.Is(run.err, ErrIdleTimeout) {
+		return run.err
+	}
+	return nil
+}
+
+// autoStart starts the connection if it isn't running and waits until it is
+// connected.
+func (l *Connection) autoStart(ctx context.Context) error {
+	for {
+		l.autoMu.Lock()
+		if l.closed || l.opts.autoStart.Err() != nil {
+			l.autoMu.Unlock()
+			return ErrClosed
+		}
+
+		run := l.autoRun
+		if run == nil {
+			run = l.startAutoRun()
+			l.autoRun = run
+		}
+		l.autoMu.Unlock()
+
+		l.stateMu.Lock()
+		up := l.up
+		l.stateMu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("error waiting for connection: %w", ctx.Err())
+		case <-up:
+			return nil
+		case <-run.done:
+			if run.connected {
+				// The connection was lost while we were waiting, so start a
+				// new one.
+				continue
+			}
+			if run.err != nil {
+				return run.err
+			}
+			return ErrNotConnected
+		}
+	}
+}
+
+func (l *Connection) startAutoRun() *autoRun {
+	ctx, cancel := context.WithCancel(l.opts.autoStart)
+	run := &autoRun{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	logger := l.opts.autoStartLogger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	l.stateMu.Lock()
+	up := l.up
+	l.stateMu.Unlock()
+
+	go func() {
+		defer cancel()
+
+		err := l.Start(ctx, logger)
+		if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, ErrIdleTimeout) {
+			logger.Warn(
+				"automatically started lircd connection stopped",
+				"err", err)
+		}
+
+		l.autoMu.Lock()
+		defer l.autoMu.Unlock()
+
+		run.err = err
+		select {
+		case <-up:
+			run.connected = true
+		default:
+		}
+		close(run.done)
+
+		// Let the next command start the connection again.
+		if l.autoRun == run {
+			l.autoRun = nil
+		}
+	}()
+
+	return run
+}
@@ -0,0 +1,31 @@
+package lirc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/neilotoole/slogt"
+)
+
+func TestAutoStart(t *testing.T) {
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, []Option{WithAutoStart(context.Background(), slogt.New(t))})
+	assert.False(t, conn.Connected(), "not connected before the first command")
+
+	_, err := conn.SendCommand(context.Background(), Version{})
+	assert.NoError(t, err, "first command starts the connection")
+	assert.True(t, conn.Connected(), "connected")
+
+	srv.hangup()
+	eventually(t, func() bool { return !conn.Connected() }, "disconnect")
+
+	_, err = conn.SendCommand(context.Background(), Version{})
+	assert.NoError(t, err, "next command starts the connection again")
+
+	assert.NoError(t, conn.Close(), "close")
+	assert.False(t, conn.Connected(), "not connected after Close")
+
+	_, err = conn.SendCommand(context.Background(), Version{})
+	assert.IsError(t, err, ErrClosed, "commands fail after Close")
+}
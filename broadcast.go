@@ -0,0 +1,71 @@
+package lirc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrMalformedBroadcast is returned by [ParseBroadcast] when a line isn't a
+// valid broadcast packet.
+var ErrMalformedBroadcast = errors.New("lirc: malformed broadcast packet")
+
+// ParseBroadcast parses a broadcast packet as sent by lircd for every decoded
+// button press, which is formatted as described in [SOCKET BROADCAST MESSAGES
+// FORMAT]:
+//
+//	<code> <repeat count> <button name> <remote control name>
+//
+// The code and repeat count are hexadecimal, as lircd writes them; note that a
+// repeat count of "10" is 16, not 10. The code may have up to 16 digits; see
+// [WithCodeWidth] for drivers that send more. Errors wrap
+// [ErrMalformedBroadcast].
+//
+// [SOCKET BROADCAST MESSAGES FORMAT]: https://www.lirc.org/html/lircd.html
+func ParseBroadcast(line string) (ButtonPress, error) {
+	return parseBroadcast(line, lircdCodeStyle.Width)
+}
+
+// parseBroadcast is ParseBroadcast with codes of up to codeWidth digits.
+func parseBroadcast(line string, codeWidth int) (ButtonPress, error) {
+	w := strings.Split(line, " ")
+	if len(w) < 4 {
+		return ButtonPress{}, fmt.Errorf("%w: has %d fields, need 4", ErrMalformedBroadcast, len(w))
+	}
+
+	if len(w[0]) > codeWidth {
+		return ButtonPress{}, fmt.Errorf("%w: code %q is longer than %d digits", ErrMalformedBroadcast, w[0], codeWidth)
+	}
+
+	code, err := ParseCode(w[0])
+	if err != nil {
+		return ButtonPress{}, fmt.Errorf("%w: code %q is not 64-bit hex", ErrMalformedBroadcast, w[0])
+	}
+
+	repeats, err := strconv.ParseUint(w[1], 16, 0)
+	if err != nil {
+		return ButtonPress{}, fmt.Errorf("%w: repeat count %q is not hex", ErrMalformedBroadcast, w[1])
+	}
+
+	return ButtonPress{
+		Code:              code,
+		RepeatCount:       uint(repeats),
+		ButtonName:        w[2],
+		RemoteControlName: w[3],
+	}, nil
+}
+
+// FormatBroadcast formats p as a broadcast packet without the trailing
+// newline. It is the inverse of [ParseBroadcast] and uses the same number of
+// digits as lircd: 16 for the code and 2 for the repeat count.
+func FormatBroadcast(p ButtonPress) string {
+	return fmt.Sprintf("%s %02x %s %s", lircdCodeStyle.Format(p.Code), p.RepeatCount, p.ButtonName, p.RemoteControlName)
+}
+
+// SimulatePress returns a [Simulate] command that makes lircd broadcast p to
+// all clients as if it had been decoded.
+func SimulatePress(p ButtonPress) Simulate {
+	key, data, _ := strings.Cut(FormatBroadcast(p), " ")
+	return Simulate{Key: key, Data: data}
+}
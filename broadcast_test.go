@@ -0,0 +1,39 @@
+package lirc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestBroadcastRoundTrip(t *testing.T) {
+	const line = "0000000000f40bf0 1a KEY_VOLUMEUP samsung"
+
+	p, err := ParseBroadcast(line)
+	assert.NoError(t, err)
+	assert.Equal(t, ButtonPress{
+		Code:              0xf40bf0,
+		RepeatCount:       0x1a,
+		ButtonName:        "KEY_VOLUMEUP",
+		RemoteControlName: "samsung",
+	}, p)
+
+	assert.Equal(t, line, FormatBroadcast(p), "format is the inverse of parse")
+
+	simulate := SimulatePress(p)
+	assert.Equal(t, "SIMULATE "+line, strings.Join(simulate.EncodeCommand(), " "),
+		"simulate command carries the packet")
+}
+
+func TestParseBroadcastMalformed(t *testing.T) {
+	for _, line := range []string{
+		"garbage",
+		"0000000000f40bf0 00 KEY_VOLUMEUP",
+		"not-hex 00 KEY_VOLUMEUP samsung",
+		"0000000000f40bf0 xx KEY_VOLUMEUP samsung",
+	} {
+		_, err := ParseBroadcast(line)
+		assert.IsError(t, err, ErrMalformedBroadcast, line)
+	}
+}
@@ -0,0 +1,77 @@
+package lirc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Capabilities describes what a lircd version supports.
+type Capabilities struct {
+	// SupportsDrvOption is whether lircd accepts [DrvOption] commands, which
+	// were added in lircd 0.9.4.
+	SupportsDrvOption bool
+	// SupportsInputLog is whether lircd accepts [SetInputLog] commands, which
+	// were added in lircd 0.9.4.
+	SupportsInputLog bool
+}
+
+// CapabilitiesOf returns the capabilities of the given lircd version, as sent
+// in reply to a [Version] command, such as "0.10.1". Anything after the
+// version numbers, such as the "c" of "0.9.4c" or a "-devel" suffix, is
+// ignored.
+func CapabilitiesOf(version string) (Capabilities, error) {
+	v, err := parseVersion(version)
+	if err != nil {
+		return Capabilities{}, err
+	}
+
+	return Capabilities{
+		SupportsDrvOption: !versionBefore(v, 0, 9, 4),
+		SupportsInputLog:  !versionBefore(v, 0, 9, 4),
+	}, nil
+}
+
+// Capabilities returns the capabilities of lircd as derived from the version
+// fetched by [WithWarmup]. It returns false if the version hasn't been fetched
+// or can't be parsed.
+func (l *Connection) Capabilities() (Capabilities, bool) {
+	l.warmupMu.Lock()
+	defer l.warmupMu.Unlock()
+	return l.capabilities, l.capabilitiesOK
+}
+
+// parseVersion parses the leading major, minor and patch numbers of a lircd
+// version. Missing numbers are 0.
+func parseVersion(version string) ([3]int, error) {
+	end := strings.IndexFunc(version, func(r rune) bool {
+		return r != '.' && (r < '0' || r > '9')
+	})
+	if end == -1 {
+		end = len(version)
+	}
+
+	var v [3]int
+	parts := strings.Split(strings.TrimSuffix(version[:end], "."), ".")
+	if len(parts) > len(v) {
+		parts = parts[:len(v)]
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return v, fmt.Errorf("invalid lircd version %q", version)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+// versionBefore returns whether v is before major.minor.patch.
+func versionBefore(v [3]int, major, minor, patch int) bool {
+	for i, n := range [3]int{major, minor, patch} {
+		if v[i] != n {
+			return v[i] < n
+		}
+	}
+	return false
+}
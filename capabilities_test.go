@@ -0,0 +1,32 @@
+package lirc
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestCapabilitiesOf(t *testing.T) {
+	tests := []struct {
+		version      string
+		capabilities Capabilities
+	}{
+		{"0.8.7", Capabilities{}},
+		{"0.9.0", Capabilities{}},
+		{"0.9.4c", Capabilities{SupportsDrvOption: true, SupportsInputLog: true}},
+		{"0.10.1", Capabilities{SupportsDrvOption: true, SupportsInputLog: true}},
+		{"0.10.2-devel", Capabilities{SupportsDrvOption: true, SupportsInputLog: true}},
+		{"1", Capabilities{SupportsDrvOption: true, SupportsInputLog: true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.version, func(t *testing.T) {
+			capabilities, err := CapabilitiesOf(test.version)
+			assert.NoError(t, err)
+			assert.Equal(t, test.capabilities, capabilities)
+		})
+	}
+
+	_, err := CapabilitiesOf("unknown")
+	assert.Error(t, err, "version without numbers")
+}
@@ -0,0 +1,188 @@
+package lirc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Button is a button of a remote control as listed by lircd.
+type Button struct {
+	// Code is the code of the button in the lircd.conf file.
+	Code uint64
+	// Name is the name of the button in the lircd.conf file.
+	Name string
+}
+
+// ParseButton parses a line of a LIST reply for a remote control. The line
+// consists of the button code in hexadecimal followed by the button name.
+func ParseButton(line string) (Button, error) {
+	code, name, ok := strings.Cut(line, " ")
+	if !ok {
+		return Button{}, fmt.Errorf("invalid button line %q", line)
+	}
+
+	c, err := ParseCode(code)
+	if err != nil {
+		return Button{}, fmt.Errorf("invalid button code %q: %w", code, err)
+	}
+
+	return Button{Code: c, Name: name}, nil
+}
+
+// ListRemotes returns the names of all remote controls defined in lircd.
+//
+// lircd does not tell whether a remote control can be used to transmit or was
+// only defined to receive, so all remote controls are returned. Sending with a
+// remote control or button that lircd doesn't know fails with an error
+// matching [ErrUnknownRemote] or [ErrUnknownButton].
+func (l *Connection) ListRemotes(ctx context.Context) ([]string, error) {
+	return listRemotes(ctx, l)
+}
+
+func listRemotes(ctx context.Context, s Sender) ([]string, error) {
+	reply, err := s.SendCommand(ctx, List{})
+	if err != nil {
+		return nil, err
+	}
+	return reply.Data, nil
+}
+
+// ListButtons returns all buttons of the given remote control.
+func (l *Connection) ListButtons(ctx context.Context, remote string) ([]Button, error) {
+	return listButtons(ctx, l, remote)
+}
+
+func listButtons(ctx context.Context, s Sender, remote string) ([]Button, error) {
+	reply, err := s.SendCommand(ctx, List{RemoteControl: remote})
+	if err != nil {
+		return nil, err
+	}
+
+	buttons := make([]Button, 0, len(reply.Data))
+	for _, line := range reply.Data {
+		button, err := ParseButton(line)
+		if err != nil {
+			return nil, err
+		}
+		buttons = append(buttons, button)
+	}
+
+	return buttons, nil
+}
+
+// NameToCode returns the code of the given button of a remote control. The
+// buttons of each remote control are listed once and cached until lircd is
+// reloaded. It fails with [ErrUnknownButton] if the remote control has no such
+// button.
+func (l *Connection) NameToCode(ctx context.Context, remote, button string) (uint64, error) {
+	buttons, err := l.cachedButtons(ctx, remote)
+	if err != nil {
+		return 0, err
+	}
+	for _, b := range buttons {
+		if b.Name == button {
+			return b.Code, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q of remote %q", ErrUnknownButton, button, remote)
+}
+
+// CodeToName returns the name of the button of a remote control that has the
+// given code, using the same cache as [Connection.NameToCode]. Several buttons
+// may have the same code, in which case the first one listed by lircd is
+// returned, which is the first one in its lircd.conf file. It fails with
+// [ErrUnknownButton] if no button has the code.
+func (l *Connection) CodeToName(ctx context.Context, remote string, code uint64) (string, error) {
+	buttons, err := l.cachedButtons(ctx, remote)
+	if err != nil {
+		return "", err
+	}
+	for _, b := range buttons {
+		if b.Code == code {
+			return b.Name, nil
+		}
+	}
+	return "", fmt.Errorf("%w: code %s of remote %q", ErrUnknownButton, FormatCode(code), remote)
+}
+
+// cachedButtons returns the buttons of remote, listing them if they aren't
+// cached yet.
+func (l *Connection) cachedButtons(ctx context.Context, remote string) ([]Button, error) {
+	l.buttonCacheMu.Lock()
+	buttons, ok := l.buttonCache[remote]
+	l.buttonCacheMu.Unlock()
+	if ok {
+		return buttons, nil
+	}
+
+	buttons, err := l.ListButtons(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+
+	l.buttonCacheMu.Lock()
+	defer l.buttonCacheMu.Unlock()
+	if l.buttonCache == nil {
+		l.buttonCache = make(map[string][]Button)
+	}
+	l.buttonCache[remote] = buttons
+	return buttons, nil
+}
+
+func (l *Connection) clearButtonCache() {
+	l.buttonCacheMu.Lock()
+	defer l.buttonCacheMu.Unlock()
+	l.buttonCache = nil
+}
+
+// ListStream is like [Connection.ListRemotes] or, if remote is not empty,
+// like listing the buttons of that remote, except that the lines of the reply
+// are sent on the returned channel as soon as they're received. The lines
+// channel is closed once the reply is complete or ctx is done. The error
+// channel then receives at most one error before being closed.
+func (l *Connection) ListStream(ctx context.Context, remote string) (<-chan string, <-chan error) {
+	lines := make(chan string)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(lines)
+
+		if _, err := l.sendCommand(ctx, List{RemoteControl: remote}, lines); err != nil {
+			errs <- err
+		}
+	}()
+
+	return lines, errs
+}
+
+// AllButtons returns the buttons of every remote control defined in lircd,
+// keyed by remote control name. The remotes are listed one at a time. If
+// listing some remotes fails, AllButtons still returns the buttons of the
+// remotes that succeeded along with an error for each remote that failed.
+func (l *Connection) AllButtons(ctx context.Context) (map[string][]Button, error) {
+	return allButtons(ctx, l)
+}
+
+func allButtons(ctx context.Context, s Sender) (map[string][]Button, error) {
+	remotes, err := listRemotes(ctx, s)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list remotes: %w", err)
+	}
+
+	all := make(map[string][]Button, len(remotes))
+	var errs []error
+
+	for _, remote := range remotes {
+		buttons, err := listButtons(ctx, s, remote)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot list buttons of remote %q: %w", remote, err))
+			continue
+		}
+		all[remote] = buttons
+	}
+
+	return all, errors.Join(errs...)
+}
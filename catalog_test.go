@@ -0,0 +1,149 @@
+package lirc
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+// mockCatalog returns a mockHandler that answers LIST commands from the given
+// remotes. Remotes missing from the catalog fail.
+func mockCatalog(remotes []string, buttons map[string][]string) mockHandler {
+	return func(line string) []string {
+		args := strings.Fields(line)
+		switch {
+		case args[0] != "LIST":
+			return mockSuccess(line)
+		case len(args) == 1:
+			return mockReply("LIST", true, remotes...)
+		case buttons[args[1]] != nil:
+			return mockReply("LIST", true, buttons[args[1]]...)
+		default:
+			return mockReply("LIST", false, "unknown remote: \""+args[1]+"\"")
+		}
+	}
+}
+
+func TestAllButtons(t *testing.T) {
+	srv := newMockServer(t, mockCatalog(
+		[]string{"tv", "amp", "projector"},
+		map[string][]string{
+			"tv":        {"00000000000040bf KEY_POWER", "00000000000020df KEY_1"},
+			"amp":       {"000000000000e01f KEY_VOLUMEUP"},
+			"projector": {"0000000000000001 KEY_MENU", "0000000000000002 KEY_OK"},
+		},
+	))
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+
+	all, err := conn.AllButtons(ctx)
+	assert.NoError(t, err, "AllButtons")
+	assert.Equal(t, map[string][]Button{
+		"tv":        {{0x40bf, "KEY_POWER"}, {0x20df, "KEY_1"}},
+		"amp":       {{0xe01f, "KEY_VOLUMEUP"}},
+		"projector": {{0x1, "KEY_MENU"}, {0x2, "KEY_OK"}},
+	}, all)
+
+	assert.Equal(t, []string{"LIST", "LIST tv", "LIST amp", "LIST projector"}, srv.received(),
+		"remotes are listed one at a time")
+}
+
+func TestAllButtonsPartial(t *testing.T) {
+	srv := newMockServer(t, mockCatalog(
+		[]string{"tv", "broken"},
+		map[string][]string{
+			"tv": {"00000000000040bf KEY_POWER"},
+		},
+	))
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+
+	all, err := conn.AllButtons(ctx)
+	assert.IsError(t, err, ErrUnsuccessfulCommand, "broken remote fails")
+	assert.Contains(t, err.Error(), `"broken"`, "error names the remote")
+	assert.Equal(t, map[string][]Button{
+		"tv": {{0x40bf, "KEY_POWER"}},
+	}, all, "partial results are returned")
+}
+
+func TestListStream(t *testing.T) {
+	buttons := []string{
+		"0000000000000001 KEY_1",
+		"0000000000000002 KEY_2",
+		"0000000000000003 KEY_3",
+	}
+
+	srv := newMockServer(t, mockCatalog([]string{"tv"}, map[string][]string{"tv": buttons}))
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+
+	t.Run("complete", func(t *testing.T) {
+		lines, errs := conn.ListStream(ctx, "tv")
+
+		var received []string
+		for line := range lines {
+			received = append(received, line)
+		}
+		assert.Equal(t, buttons, received, "all lines are streamed")
+		assert.NoError(t, <-errs, "no error")
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		lines, errs := conn.ListStream(ctx, "tv")
+
+		assert.Equal(t, buttons[0], <-lines, "first line is streamed")
+		cancel()
+
+		for range lines {
+			// Drain whatever was in flight when ctx was canceled.
+		}
+		assert.IsError(t, <-errs, context.Canceled, "stream is canceled")
+	})
+
+	_, err := conn.SendCommand(ctx, Version{})
+	assert.NoError(t, err, "connection is usable after a canceled stream")
+}
+
+func TestNameToCode(t *testing.T) {
+	srv := newMockServer(t, mockCatalog([]string{"tv"}, map[string][]string{
+		// KEY_OK and KEY_ENTER are the same button.
+		"tv": {"00000000000040bf KEY_POWER", "000000000000827d KEY_OK", "000000000000827d KEY_ENTER"},
+	}))
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+
+	code, err := conn.NameToCode(ctx, "tv", "KEY_ENTER")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0x827d), code)
+
+	name, err := conn.CodeToName(ctx, "tv", 0x827d)
+	assert.NoError(t, err)
+	assert.Equal(t, "KEY_OK", name, "first button with a duplicate code")
+
+	name, err = conn.CodeToName(ctx, "tv", 0x40bf)
+	assert.NoError(t, err)
+	assert.Equal(t, "KEY_POWER", name)
+
+	_, err = conn.NameToCode(ctx, "tv", "KEY_MUTE")
+	assert.IsError(t, err, ErrUnknownButton)
+	_, err = conn.CodeToName(ctx, "tv", 0x1)
+	assert.IsError(t, err, ErrUnknownButton)
+	_, err = conn.NameToCode(ctx, "amp", "KEY_POWER")
+	assert.IsError(t, err, ErrUnknownRemote)
+
+	assert.Equal(t, []string{"LIST tv", "LIST amp"}, srv.received(), "buttons are listed once")
+
+	srv.broadcast("BEGIN", "SIGHUP", "END")
+	// The reply is read after SIGHUP, so the reload has been handled once it
+	// arrives.
+	_, err = conn.SendCommand(ctx, Version{})
+	assert.NoError(t, err)
+
+	_, err = conn.NameToCode(ctx, "tv", "KEY_POWER")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"LIST tv", "LIST amp", "VERSION", "LIST tv"}, srv.received(),
+		"buttons are listed again after a reload")
+}
@@ -0,0 +1,35 @@
+package lirc
+
+import "time"
+
+// clock is the source of time for the package. All time usage goes through it
+// so that tests can control time.
+//
+// Durations are only computed with [time.Time.Sub] and comparisons between
+// times returned by Now, which keep the monotonic clock reading of
+// [time.Now], so that steps of the system time, such as by NTP, don't affect
+// them. Times must not be stored in a way that drops the reading, such as Unix
+// nanoseconds. The fake clock used by tests only ever moves forward.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) timer
+}
+
+// timer is a [time.Timer] created by a clock.
+type timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// realClock is the clock backed by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTimer(d time.Duration) timer         { return realTimer{time.NewTimer(d)} }
+
+type realTimer struct{ *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.Timer.C }
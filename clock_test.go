@@ -0,0 +1,177 @@
+package lirc
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+// fakeClock is a clock that only moves when Advance is called.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) timer {
+	t := &fakeTimer{clock: c, ch: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// Advance moves the clock forward by d, firing every timer that expires on the
+// way in deadline order.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	end := c.now.Add(d)
+	for len(c.timers) > 0 {
+		next := slices.MinFunc(c.timers, func(a, b *fakeTimer) int {
+			return a.deadline.Compare(b.deadline)
+		})
+		if next.deadline.After(end) {
+			break
+		}
+
+		c.timers = slices.DeleteFunc(c.timers, func(t *fakeTimer) bool { return t == next })
+		c.now = next.deadline
+
+		select {
+		case next.ch <- c.now:
+		default:
+		}
+	}
+	c.now = end
+}
+
+// Timers returns the number of active timers. Tests use it to wait for code
+// to arm a timer before advancing the clock.
+func (c *fakeClock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// HasTimer returns whether a timer is set to fire exactly d from now. Tests use
+// it to wait for a specific timer to be armed.
+func (c *fakeClock) HasTimer(d time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deadline := c.now.Add(d)
+	return slices.ContainsFunc(c.timers, func(t *fakeTimer) bool { return t.deadline.Equal(deadline) })
+}
+
+type fakeTimer struct {
+	clock    *fakeClock
+	ch       chan time.Time
+	deadline time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.stop()
+}
+
+func (t *fakeTimer) stop() bool {
+	i := slices.Index(t.clock.timers, t)
+	if i == -1 {
+		return false
+	}
+	t.clock.timers = slices.Delete(t.clock.timers, i, i+1)
+	return true
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	active := t.stop()
+	t.deadline = t.clock.now.Add(d)
+	t.clock.timers = append(t.clock.timers, t)
+	return active
+}
+
+func TestFakeClock(t *testing.T) {
+	clock := newFakeClock()
+	start := clock.Now()
+
+	late := clock.NewTimer(2 * time.Second)
+	early := clock.After(time.Second)
+	stopped := clock.NewTimer(time.Second)
+	assert.True(t, stopped.Stop(), "stop active timer")
+
+	clock.Advance(1500 * time.Millisecond)
+	assert.Equal(t, start.Add(time.Second), <-early, "early timer fires at its deadline")
+	assert.Equal(t, 1, clock.Timers(), "late timer is still active")
+
+	clock.Advance(time.Second)
+	assert.Equal(t, start.Add(2*time.Second), <-late.C(), "late timer fires at its deadline")
+	assert.Equal(t, start.Add(2500*time.Millisecond), clock.Now(), "clock advanced")
+
+	select {
+	case <-stopped.C():
+		t.Fatal("stopped timer fired")
+	default:
+	}
+}
+
+// hasMonotonic returns whether t has a monotonic clock reading, which
+// [time.Time.String] prints as "m=".
+func hasMonotonic(t time.Time) bool {
+	return strings.Contains(t.String(), " m=")
+}
+
+func TestRealClockMonotonic(t *testing.T) {
+	start := realClock{}.Now()
+	assert.True(t, hasMonotonic(start), "readings are monotonic")
+	assert.True(t, hasMonotonic(start.Add(time.Hour)), "times computed from readings stay monotonic")
+	assert.False(t, hasMonotonic(start.Round(0)), "rounding drops the monotonic reading")
+}
+
+func TestSendCommandTimeout(t *testing.T) {
+	clock := newFakeClock()
+	srv := newMockServer(t, func(string) []string { return nil })
+	conn := newConnection(srv.dial, []Option{withClock(clock)})
+	ctx := startTestConnection(t, conn)
+
+	errCh := make(chan error)
+	go func() {
+		_, err := conn.SendCommand(ctx, Version{})
+		errCh <- err
+	}()
+
+	eventually(t, func() bool { return clock.Timers() == 1 }, "reply timeout to be armed")
+	clock.Advance(replyTimeout - time.Second)
+	select {
+	case err := <-errCh:
+		t.Fatal("SendCommand returned before the timeout:", err)
+	default:
+	}
+
+	clock.Advance(time.Second)
+	assert.IsError(t, <-errCh, context.DeadlineExceeded, "reply timeout")
+}
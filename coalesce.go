@@ -0,0 +1,64 @@
+package lirc
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// coalesceLoop delivers the events handed to it by deliverEvent, collapsing
+// the repeats of a button received within the coalescing window into one event
+// as described in WithCoalescing.
+func (l *Connection) coalesceLoop(ctx context.Context, logger *slog.Logger) {
+	var (
+		pending ButtonPress
+		window  timer // nil unless pending is set
+		expired <-chan time.Time
+	)
+
+	flush := func() {
+		if window == nil {
+			return
+		}
+		window.Stop()
+		window, expired = nil, nil
+		l.emitEvent(ctx, logger, pending)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if window != nil {
+				window.Stop()
+			}
+			return
+
+		case <-expired:
+			flush()
+
+		case event := <-l.coalesce:
+			if window != nil && event.RepeatCount > 0 && sameButton(event, pending) {
+				pending.RepeatCount = max(pending.RepeatCount, event.RepeatCount)
+				pending.Raw = event.Raw
+				continue
+			}
+
+			flush()
+			if event.RepeatCount == 0 {
+				l.emitEvent(ctx, logger, event)
+				continue
+			}
+
+			pending = event
+			window = l.opts.clock.NewTimer(l.opts.coalesceWindow)
+			expired = window.C()
+		}
+	}
+}
+
+// sameButton returns whether a and b are presses of the same button.
+func sameButton(a, b ButtonPress) bool {
+	return a.RemoteControlName == b.RemoteControlName &&
+		a.ButtonName == b.ButtonName &&
+		a.Code == b.Code
+}
@@ -0,0 +1,75 @@
+package lirc
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/neilotoole/slogt"
+)
+
+func TestCoalescing(t *testing.T) {
+	const window = 50 * time.Millisecond
+
+	clock := newFakeClock()
+	conn := newConnection(nil, []Option{withClock(clock), WithCoalescing(window)})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go conn.coalesceLoop(ctx, slogt.New(t))
+
+	// Events are handed over synchronously, so each one has been received
+	// by the time the next one is sent.
+	press := func(button string, repeats ...uint) {
+		for _, repeat := range repeats {
+			conn.coalesce <- ButtonPress{RepeatCount: repeat, ButtonName: button, RemoteControlName: "remote"}
+		}
+	}
+
+	press("KEY_UP", 0)
+	assert.Equal(t, uint(0), (<-conn.Events).RepeatCount, "first press is delivered right away")
+
+	press("KEY_UP", 1, 2, 3)
+	assert.True(t, clock.HasTimer(window), "coalescing window")
+	clock.Advance(window)
+	assert.Equal(t, uint(3), (<-conn.Events).RepeatCount, "repeats are coalesced")
+
+	press("KEY_UP", 4, 5)
+	go press("KEY_DOWN", 0)
+	event := <-conn.Events
+	assert.Equal(t, "KEY_UP", event.ButtonName, "pending repeat is flushed by another button")
+	assert.Equal(t, uint(5), event.RepeatCount, "highest repeat count")
+	assert.Equal(t, "KEY_DOWN", (<-conn.Events).ButtonName, "other button")
+}
+
+func BenchmarkCoalescing(b *testing.B) {
+	for _, window := range []time.Duration{0, time.Hour} {
+		b.Run("window="+window.String(), func(b *testing.B) {
+			conn := newConnection(nil, []Option{WithCoalescing(window)})
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if conn.coalesce != nil {
+				go conn.coalesceLoop(ctx, logger)
+			}
+			go func() {
+				for range conn.Events {
+				}
+			}()
+
+			b.ResetTimer()
+			for i := range b.N {
+				conn.deliverEvent(ctx, logger, ButtonPress{
+					RepeatCount:       uint(i + 1),
+					ButtonName:        "KEY_VOLUMEUP",
+					RemoteControlName: "remote",
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package lirc
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CodeStyle describes how button codes are formatted as strings.
+type CodeStyle struct {
+	// Width is the minimum number of digits. Shorter codes are padded with
+	// leading zeros.
+	Width int
+	// Uppercase uses uppercase hexadecimal digits.
+	Uppercase bool
+	// Prefix prepends "0x" to the digits.
+	Prefix bool
+}
+
+// lircdCodeStyle is how lircd formats codes in broadcast packets.
+var lircdCodeStyle = CodeStyle{Width: 16}
+
+// DefaultCodeStyle is the style used by [FormatCode], which is also used to
+// format codes in [ButtonPress.String] and [ButtonPress.MarshalJSON]. It
+// defaults to lircd's own style: 16 lowercase digits. Broadcast packets built
+// by [FormatBroadcast] always use lircd's style.
+var DefaultCodeStyle = lircdCodeStyle
+
+// FormatCode formats code using [DefaultCodeStyle].
+func FormatCode(code uint64) string {
+	return DefaultCodeStyle.Format(code)
+}
+
+// Format formats code in the style.
+func (s CodeStyle) Format(code uint64) string {
+	digits := strconv.FormatUint(code, 16)
+	if len(digits) < s.Width {
+		digits = strings.Repeat("0", s.Width-len(digits)) + digits
+	}
+	if s.Uppercase {
+		digits = strings.ToUpper(digits)
+	}
+	if s.Prefix {
+		digits = "0x" + digits
+	}
+	return digits
+}
+
+// ParseCode parses a hexadecimal button code formatted in any [CodeStyle].
+func ParseCode(s string) (uint64, error) {
+	digits := s
+	if len(digits) > 2 && digits[0] == '0' && (digits[1] == 'x' || digits[1] == 'X') {
+		digits = digits[2:]
+	}
+	return strconv.ParseUint(digits, 16, 64)
+}
@@ -0,0 +1,53 @@
+package lirc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestCodeStyle(t *testing.T) {
+	const code = 0xe0e040bf
+
+	tests := []struct {
+		name  string
+		style CodeStyle
+		want  string
+	}{
+		{"lircd", lircdCodeStyle, "00000000e0e040bf"},
+		{"short", CodeStyle{}, "e0e040bf"},
+		{"uppercase", CodeStyle{Width: 12, Uppercase: true}, "0000E0E040BF"},
+		{"prefix", CodeStyle{Prefix: true, Uppercase: true}, "0xE0E040BF"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := test.style.Format(code)
+			assert.Equal(t, test.want, s, "format")
+
+			parsed, err := ParseCode(s)
+			assert.NoError(t, err)
+			assert.Equal(t, uint64(code), parsed, "parse is the inverse of format")
+		})
+	}
+
+	_, err := ParseCode("0x")
+	assert.Error(t, err, "prefix without digits")
+}
+
+func TestButtonPressJSON(t *testing.T) {
+	p := ButtonPress{Code: 0xe0e040bf, RepeatCount: 2, ButtonName: "KEY_POWER", RemoteControlName: "tv"}
+
+	b, err := json.Marshal(p)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		`{"code":"00000000e0e040bf","repeatCount":2,"buttonName":"KEY_POWER","remoteControlName":"tv"}`,
+		string(b))
+
+	var decoded ButtonPress
+	assert.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, p, decoded, "round trip")
+
+	assert.Equal(t, "tv KEY_POWER (00000000e0e040bf) repeat 2", p.String())
+}
@@ -0,0 +1,37 @@
+package lirc
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// commandLogTime is the format of the timestamps written by WithCommandLog.
+const commandLogTime = "2006-01-02T15:04:05.000Z07:00"
+
+// logCommand writes the line of the command log for a command that was
+// written to lircd.
+func (l *Connection) logCommand(sentAt time.Time, raw string) {
+	l.writeCommandLog(sentAt, "command "+strings.TrimSuffix(raw, "\n"))
+}
+
+// logReply writes the line of the command log for a reply received from
+// lircd.
+func (l *Connection) logReply(reply CommandReply) {
+	result := "success"
+	if !reply.Success {
+		result = "error"
+	}
+	l.writeCommandLog(l.opts.clock.Now(), fmt.Sprintf(
+		"reply %s: %s, %d data lines", reply.Command, result, len(reply.Data)))
+}
+
+func (l *Connection) writeCommandLog(t time.Time, line string) {
+	// The sender and reader goroutines both write to the log.
+	l.commandLogMu.Lock()
+	defer l.commandLogMu.Unlock()
+
+	// The log is best effort, so a failing writer doesn't break the
+	// connection.
+	fmt.Fprintf(l.opts.commandLog, "%s %s\n", t.Format(commandLogTime), line)
+}
@@ -0,0 +1,52 @@
+package lirc
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+// syncBuffer is a strings.Builder that is safe for concurrent use.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.String()
+}
+
+func TestCommandLog(t *testing.T) {
+	var log syncBuffer
+	srv := newMockServer(t, func(line string) []string {
+		if line == "VERSION" {
+			return mockReply(line, true, "0.10.2")
+		}
+		return mockReply(line, false, `unknown remote: "tv"`)
+	})
+	conn := newConnection(srv.dial, []Option{WithCommandLog(&log), withClock(newFakeClock())})
+	ctx := startTestConnection(t, conn)
+
+	_, err := conn.SendCommand(ctx, Version{})
+	assert.NoError(t, err)
+	_, err = conn.SendCommand(ctx, SendOnce{RemoteControl: "tv", ButtonName: "KEY_POWER"})
+	assert.IsError(t, err, ErrUnknownRemote)
+
+	assert.Equal(t, strings.Join([]string{
+		"2024-01-01T00:00:00.000Z command VERSION",
+		"2024-01-01T00:00:00.000Z reply VERSION: success, 1 data lines",
+		"2024-01-01T00:00:00.000Z command SEND_ONCE tv KEY_POWER",
+		"2024-01-01T00:00:00.000Z reply SEND_ONCE tv KEY_POWER: error, 1 data lines",
+		"",
+	}, "\n"), log.String())
+}
@@ -1,6 +1,12 @@
 package lirc
 
-import "strconv"
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
 
 // Command describes a command that can be sent to lirc.
 type Command interface {
@@ -8,12 +14,112 @@ type Command interface {
 	EncodeCommand() []string
 }
 
+// ErrInvalidCommand is returned when a command can't be sent because lircd
+// would misparse it, such as when an argument is empty or has spaces.
+var ErrInvalidCommand = errors.New("lirc: invalid command")
+
+// DryEncode returns the line that sending the command writes to lircd,
+// including the trailing newline, without sending it and without any
+// connection options applied; see [Connection.DryEncode] for those. It fails
+// like sending the command would if the command is invalid. Errors wrap
+// [ErrInvalidCommand].
+func DryEncode(command Command) (string, error) {
+	command = unwrapCommand(command)
+	if err := validateCommand(command); err != nil {
+		return "", err
+	}
+	return encodeCommand(command, nil), nil
+}
+
+// DryEncode is like the DryEncode function, but it applies the options of the
+// connection, such as [WithDefaultRepeats], [WithCommandPrefix] and
+// [WithCommandEncoder], so the line is exactly what sending the command on the
+// connection writes. It fails like [Connection.SendCommand] for commands the
+// connection won't send, such as with [WithAllowedRemotes].
+func (l *Connection) DryEncode(command Command) (string, error) {
+	command, err := l.prepareCommand(command)
+	if err != nil {
+		return "", err
+	}
+	return encodeCommand(command, l.opts.commandEncoder, l.opts.commandPrefix...), nil
+}
+
+// encodeCommand returns the line written to lircd for command, with the
+// tokens of prefix written before it. The arguments are joined by encode, or
+// with spaces if it is nil.
+func encodeCommand(command Command, encode func(args []string) string, prefix ...string) string {
+	args := append(slices.Clip(prefix), command.EncodeCommand()...)
+	if encode == nil {
+		return strings.Join(args, " ") + "\n"
+	}
+	return encode(args) + "\n"
+}
+
+// validateEncoded checks that the line written to lircd for command by a
+// custom encoder is a single line. The encoder is trusted with the rest.
+func validateEncoded(command Command, encode func(args []string) string) error {
+	encoded := command.EncodeCommand()
+	if len(encoded) == 0 || encoded[0] == "" {
+		return fmt.Errorf("%w: no command verb", ErrInvalidCommand)
+	}
+
+	line := encodeCommand(command, encode)
+	if strings.ContainsAny(strings.TrimSuffix(line, "\n"), "\r\n") {
+		return fmt.Errorf("%w: encoded %s command has a line break", ErrInvalidCommand, encoded[0])
+	}
+	return nil
+}
+
+// validatePrefix checks that the tokens set by WithCommandPrefix don't break
+// the commands they are written before.
+func validatePrefix(prefix []string) error {
+	for _, token := range prefix {
+		if token == "" {
+			return fmt.Errorf("%w: command prefix has an empty token", ErrInvalidCommand)
+		}
+		if strings.ContainsAny(token, " \t\r\n") {
+			return fmt.Errorf("%w: command prefix token %q has spaces or line breaks", ErrInvalidCommand, token)
+		}
+	}
+	return nil
+}
+
+// validateCommand checks that lircd parses command as it is meant to be: that
+// it has a verb and that none of its arguments are empty or would be split
+// into several.
+func validateCommand(command Command) error {
+	encoded := command.EncodeCommand()
+	if len(encoded) == 0 || encoded[0] == "" {
+		return fmt.Errorf("%w: no command verb", ErrInvalidCommand)
+	}
+
+	for i, arg := range encoded {
+		if arg == "" {
+			return fmt.Errorf("%w: %s argument %d is empty", ErrInvalidCommand, encoded[0], i)
+		}
+		if strings.ContainsAny(arg, "\r\n") {
+			return fmt.Errorf("%w: %s argument %d has a line break", ErrInvalidCommand, encoded[0], i)
+		}
+		// The data of Simulate is the rest of a broadcast packet, so it has
+		// spaces, and lircd takes the rest of the line for it.
+		if _, ok := command.(Simulate); ok && i == len(encoded)-1 {
+			continue
+		}
+		if strings.ContainsAny(arg, " \t") {
+			return fmt.Errorf("%w: %s argument %q has spaces", ErrInvalidCommand, encoded[0], arg)
+		}
+	}
+	return nil
+}
+
 // SendOnce tells lircd to send the IR signal associated with the given remote
 // control and button name, and then repeat it repeats times. repeats is a
 // decimal number between 0 and repeat_max. The latter can be given as a
 // --repeat-max command line argument to lircd, and defaults to 600. If repeats
 // is not specified or is less than the minimum number of repeats for the
-// selected remote control, the minimum value will be used.
+// selected remote control, the minimum value will be used; lircd.conf files
+// can be read with [RemoteMinRepeat] to find it. lircd can't send raw pulses
+// and spaces; see [FormatRawRemote] for a way around it.
 type SendOnce struct {
 	RemoteControl string
 	ButtonName    string
@@ -66,7 +172,8 @@ func (l List) EncodeCommand() []string {
 }
 
 // SetInputLog starts logging all received data on that file. The log is printable
-// lines as defined in mode2(1) describing pulse/space durations.
+// lines as defined in mode2(1) describing pulse/space durations, which
+// [ParseMode2] decodes.
 type SetInputLog struct {
 	Path string
 }
@@ -96,7 +203,9 @@ func (d DrvOption) EncodeCommand() []string {
 // this key has been decoded. The key data must be formatted exactly as the packet
 // described in [SOCKET BROADCAST MESSAGES FORMAT], notably is the number of digits
 // in code and repeat count hardcoded. This command is only accepted if the
-// --allow-simulate command line option is active.
+// --allow-simulate command line option is active, which
+// [Connection.SupportsSimulate] checks. See [SimulatePress] to build it from a
+// [ButtonPress].
 type Simulate struct {
 	Key  string
 	Data string
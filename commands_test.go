@@ -0,0 +1,112 @@
+package lirc
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestDryEncode(t *testing.T) {
+	valid := []struct {
+		command Command
+		line    string
+	}{
+		{SendOnce{RemoteControl: "tv", ButtonName: "KEY_POWER", Repeats: 2}, "SEND_ONCE tv KEY_POWER 2\n"},
+		{List{}, "LIST\n"},
+		{Idempotent(Version{}), "VERSION\n"},
+		{SimulatePress(ButtonPress{Code: 0xe0e040bf, ButtonName: "KEY_POWER", RemoteControlName: "tv"}),
+			"SIMULATE 00000000e0e040bf 00 KEY_POWER tv\n"},
+	}
+	for _, test := range valid {
+		line, err := DryEncode(test.command)
+		assert.NoError(t, err, test.line)
+		assert.Equal(t, test.line, line)
+	}
+
+	invalid := []Command{
+		SendOnce{RemoteControl: "tv"},
+		SendOnce{RemoteControl: "living room", ButtonName: "KEY_POWER"},
+		SendStart{RemoteControl: "tv", ButtonName: "KEY_POWER\nSEND_ONCE tv KEY_MUTE"},
+		Simulate{Key: "00000000e0e040bf", Data: "00 KEY_POWER tv\n"},
+	}
+	for _, command := range invalid {
+		_, err := DryEncode(command)
+		assert.IsError(t, err, ErrInvalidCommand, "%#v", command)
+	}
+}
+
+func TestConnectionDryEncode(t *testing.T) {
+	conn := newConnection(nil, []Option{
+		WithDefaultRepeats(3),
+		WithCommandPrefix("seat0"),
+		WithCommandEncoder(func(args []string) string { return strings.Join(args, "\t") }),
+		WithAllowedRemotes("tv"),
+	})
+
+	line, err := conn.DryEncode(SendOnce{RemoteControl: "tv", ButtonName: "KEY_POWER"})
+	assert.NoError(t, err)
+	assert.Equal(t, "seat0\tSEND_ONCE\ttv\tKEY_POWER\t3\n", line, "options are applied")
+
+	_, err = conn.DryEncode(SendOnce{RemoteControl: "amp", ButtonName: "KEY_POWER"})
+	assert.IsError(t, err, ErrRemoteNotAllowed, "fails like sending")
+
+	line, err = DryEncode(SendOnce{RemoteControl: "tv", ButtonName: "KEY_POWER"})
+	assert.NoError(t, err)
+	assert.Equal(t, "SEND_ONCE tv KEY_POWER\n", line, "function ignores the options")
+}
+
+func TestCommandPrefix(t *testing.T) {
+	srv := newMockServer(t, func(line string) []string {
+		// Reply like lircd behind a proxy that strips the prefix.
+		return mockReply(strings.TrimPrefix(line, "seat0 session1 "), true)
+	})
+	conn := newConnection(srv.dial, []Option{WithCommandPrefix("seat0", "session1")})
+	ctx := startTestConnection(t, conn)
+
+	_, err := conn.SendCommand(ctx, SendOnce{RemoteControl: "tv", ButtonName: "KEY_POWER"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"seat0 session1 SEND_ONCE tv KEY_POWER"}, srv.received(),
+		"prefix is written ahead of the command")
+
+	srv = newMockServer(t, mockSuccess)
+	conn = newConnection(srv.dial, []Option{WithCommandPrefix("seat0")})
+	ctx = startTestConnection(t, conn)
+
+	_, err = conn.SendCommand(ctx, Version{})
+	assert.NoError(t, err, "replies echoing the prefix match too")
+
+	conn = newConnection(srv.dial, []Option{WithCommandPrefix("seat0\nVERSION")})
+	_, err = conn.SendCommand(ctx, Version{})
+	assert.IsError(t, err, ErrInvalidCommand, "prefix can't have line breaks")
+}
+
+func TestCommandEncoder(t *testing.T) {
+	quote := func(args []string) string {
+		quoted := make([]string, len(args))
+		for i, arg := range args {
+			if strings.ContainsAny(arg, " \t\r\n") {
+				arg = strconv.Quote(arg)
+			}
+			quoted[i] = arg
+		}
+		return strings.Join(quoted, " ")
+	}
+
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, []Option{WithCommandEncoder(quote)})
+	ctx := startTestConnection(t, conn)
+
+	_, err := conn.SendCommand(ctx, SendOnce{RemoteControl: "living room", ButtonName: "KEY_POWER"})
+	assert.NoError(t, err, "spaces are allowed with a custom encoder")
+	assert.Equal(t, []string{`SEND_ONCE "living room" KEY_POWER`}, srv.received())
+
+	_, err = conn.SendCommand(ctx, SendOnce{RemoteControl: "tv\nVERSION", ButtonName: "KEY_POWER"})
+	assert.NoError(t, err, "the encoder escapes line breaks")
+
+	raw := func(args []string) string { return strings.Join(args, " ") }
+	conn = newConnection(srv.dial, []Option{WithCommandEncoder(raw)})
+	_, err = conn.SendCommand(ctx, SendOnce{RemoteControl: "tv\nVERSION", ButtonName: "KEY_POWER"})
+	assert.IsError(t, err, ErrInvalidCommand, "encoded lines can't have line breaks")
+}
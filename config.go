@@ -0,0 +1,274 @@
+package lirc
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrMalformedConfig is returned by [ParseRemoteConfig] when a lircd.conf file
+// can't be parsed.
+var ErrMalformedConfig = errors.New("lirc: malformed lircd.conf")
+
+// ErrInvalidSignal is returned by [FormatRawRemote] when a signal can't be
+// written as raw codes.
+var ErrInvalidSignal = errors.New("lirc: invalid raw signal")
+
+// RemoteConfig is a remote control defined in a lircd.conf file, as described
+// in [lircd.conf(5)]. Only the parts that lircd doesn't tell over its socket
+// are parsed.
+//
+// [lircd.conf(5)]: https://www.lirc.org/html/lircd.conf.html
+type RemoteConfig struct {
+	// Name is the name of the remote control.
+	Name string
+	// MinRepeat is the minimum number of times lircd repeats the signals it
+	// sends, which [SendOnce] uses if it is given fewer repeats. It is 0 if
+	// the remote control doesn't set min_repeat.
+	MinRepeat uint
+	// Buttons are the buttons of the codes section, which have the codes as
+	// written in the file. Buttons defined by raw codes aren't included.
+	Buttons []Button
+}
+
+// ParseRemoteConfig parses the remote controls defined in a lircd.conf file.
+// lircd doesn't send the minimum number of repeats of a remote control over
+// its socket, so reading its configuration is the only way to find it; see
+// [RemoteMinRepeat]. Errors wrap [ErrMalformedConfig].
+func ParseRemoteConfig(r io.Reader) ([]RemoteConfig, error) {
+	const (
+		outside = iota
+		inRemote
+		inCodes
+		inRawCodes
+	)
+
+	var remotes []RemoteConfig
+	var remote RemoteConfig
+	state := outside
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		malformed := func(format string, args ...any) error {
+			return fmt.Errorf("%w: line %d: %s", ErrMalformedConfig, n, fmt.Sprintf(format, args...))
+		}
+
+		switch state {
+		case outside:
+			if len(fields) != 2 || fields[0] != "begin" || fields[1] != "remote" {
+				return nil, malformed("unexpected %q outside of a remote", line)
+			}
+			remote = RemoteConfig{}
+			state = inRemote
+
+		case inRemote:
+			switch fields[0] {
+			case "begin":
+				switch {
+				case len(fields) == 2 && fields[1] == "codes":
+					state = inCodes
+				case len(fields) == 2 && fields[1] == "raw_codes":
+					state = inRawCodes
+				default:
+					return nil, malformed("unexpected %q", line)
+				}
+			case "end":
+				if remote.Name == "" {
+					return nil, malformed("remote has no name")
+				}
+				remotes = append(remotes, remote)
+				state = outside
+			case "name":
+				if len(fields) != 2 {
+					return nil, malformed("invalid name %q", line)
+				}
+				remote.Name = fields[1]
+			case "min_repeat":
+				if len(fields) != 2 {
+					return nil, malformed("invalid min_repeat %q", line)
+				}
+				// lircd reads numbers in C notation, so they may be
+				// hexadecimal or octal.
+				v, err := strconv.ParseUint(fields[1], 0, 32)
+				if err != nil {
+					return nil, malformed("min_repeat %q is not a number", fields[1])
+				}
+				remote.MinRepeat = uint(v)
+			}
+
+		case inCodes:
+			if fields[0] == "end" {
+				state = inRemote
+				continue
+			}
+			if len(fields) < 2 {
+				return nil, malformed("button %q has no code", fields[0])
+			}
+			code, err := ParseCode(fields[1])
+			if err != nil {
+				return nil, malformed("button %q has invalid code %q", fields[0], fields[1])
+			}
+			remote.Buttons = append(remote.Buttons, Button{Code: code, Name: fields[0]})
+
+		case inRawCodes:
+			if fields[0] == "end" {
+				state = inRemote
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading lircd.conf: %w", err)
+	}
+
+	if state != outside {
+		return nil, fmt.Errorf("%w: remote %q is not ended", ErrMalformedConfig, remote.Name)
+	}
+	return remotes, nil
+}
+
+// RemoteMinRepeat returns the minimum number of repeats of the remote control
+// with the given name among remotes, as parsed by [ParseRemoteConfig]. It fails
+// with [ErrUnknownRemote] if there is no such remote control.
+func RemoteMinRepeat(remotes []RemoteConfig, name string) (uint, error) {
+	for _, remote := range remotes {
+		if remote.Name == name {
+			return remote.MinRepeat, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownRemote, name)
+}
+
+// defaultRawGap is the gap of the remote controls written by FormatRawRemote
+// if they don't set one, which is longer than the gap of most protocols.
+const defaultRawGap = 100 * time.Millisecond
+
+// RawRemote is a remote control whose buttons are defined by raw codes, which
+// lircd sends as-is.
+type RawRemote struct {
+	// Name is the name of the remote control.
+	Name string
+	// Frequency is the carrier frequency in Hz. If 0, lircd uses 38 kHz.
+	Frequency uint
+	// Gap is the space lircd leaves between repeats of a signal. If 0, it is
+	// 100ms.
+	Gap time.Duration
+	// Buttons are the buttons of the remote control.
+	Buttons []RawButton
+}
+
+// RawButton is a button of a [RawRemote].
+type RawButton struct {
+	// Name is the name of the button.
+	Name string
+	// Signal is the signal sent by the button, as decoded by [ParseMode2]. It
+	// starts with a pulse and alternates between pulses and spaces. Spaces at
+	// either end, such as the timeout logged after a signal, are left out,
+	// since lircd adds the gap of the remote control instead.
+	Signal []PulseSpace
+}
+
+// FormatRawRemote writes remote as a lircd.conf file with a raw_codes
+// section, as described in [lircd.conf(5)].
+//
+// lircd's socket has no command to send a raw pulse and space sequence: it only
+// sends the buttons of the remote controls in its configuration. The closest
+// supported way to send a recorded signal is to write it with FormatRawRemote
+// into lircd's configuration directory, usually /etc/lirc/lircd.conf.d, make
+// lircd reload its configuration, such as by sending it SIGHUP, and then send
+// the button with [SendOnce]. Fails with [ErrInvalidSignal] if a signal is empty
+// or doesn't alternate between pulses and spaces, and with [ErrInvalidCommand]
+// if a name couldn't be sent with SendOnce.
+//
+// [lircd.conf(5)]: https://www.lirc.org/html/lircd.conf.html
+func FormatRawRemote(remote RawRemote) (string, error) {
+	validName := func(kind, name string) error {
+		if name == "" || strings.ContainsAny(name, " \t\r\n#") {
+			return fmt.Errorf("%w: invalid %s name %q", ErrInvalidCommand, kind, name)
+		}
+		return nil
+	}
+
+	if err := validName("remote", remote.Name); err != nil {
+		return "", err
+	}
+
+	gap := cmp.Or(remote.Gap, defaultRawGap)
+
+	var b strings.Builder
+	b.WriteString("begin remote\n")
+	fmt.Fprintf(&b, "  name  %s\n", remote.Name)
+	b.WriteString("  flags RAW_CODES\n")
+	b.WriteString("  eps            30\n")
+	b.WriteString("  aeps          100\n")
+	if remote.Frequency > 0 {
+		fmt.Fprintf(&b, "  frequency  %d\n", remote.Frequency)
+	}
+	fmt.Fprintf(&b, "  gap          %d\n", gap.Microseconds())
+	b.WriteString("\n")
+	b.WriteString("  begin raw_codes\n")
+
+	for _, button := range remote.Buttons {
+		if err := validName("button", button.Name); err != nil {
+			return "", err
+		}
+
+		durations, err := rawDurations(button.Signal)
+		if err != nil {
+			return "", fmt.Errorf("button %q: %w", button.Name, err)
+		}
+
+		fmt.Fprintf(&b, "    name %s\n", button.Name)
+		// Six durations per line, like irrecord.
+		for line := range (len(durations) + 5) / 6 {
+			b.WriteString("     ")
+			for _, d := range durations[line*6 : min(line*6+6, len(durations))] {
+				fmt.Fprintf(&b, " %7d", d)
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("  end raw_codes\n")
+	b.WriteString("end remote\n")
+	return b.String(), nil
+}
+
+// rawDurations returns the durations of signal in microseconds, without the
+// spaces at either end.
+func rawDurations(signal []PulseSpace) ([]int64, error) {
+	first, last := 0, len(signal)
+	for first < last && !signal[first].Pulse {
+		first++
+	}
+	for last > first && !signal[last-1].Pulse {
+		last--
+	}
+	if first == last {
+		return nil, fmt.Errorf("%w: no pulses", ErrInvalidSignal)
+	}
+
+	durations := make([]int64, 0, last-first)
+	for i := first; i < last; i++ {
+		p := signal[i]
+		if p.Pulse != ((i-first)%2 == 0) {
+			return nil, fmt.Errorf("%w: item %d doesn't alternate between pulses and spaces", ErrInvalidSignal, i)
+		}
+		if p.Duration < time.Microsecond {
+			return nil, fmt.Errorf("%w: item %d is shorter than a microsecond", ErrInvalidSignal, i)
+		}
+		durations = append(durations, p.Duration.Microseconds())
+	}
+	return durations, nil
+}
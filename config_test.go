@@ -0,0 +1,119 @@
+package lirc
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestParseRemoteConfig(t *testing.T) {
+	parse := func(path string) []RemoteConfig {
+		f, err := os.Open(path)
+		assert.NoError(t, err)
+		defer f.Close()
+
+		remotes, err := ParseRemoteConfig(f)
+		assert.NoError(t, err)
+		return remotes
+	}
+
+	remotes := parse("testdata/remotes/sony/RM-ED035.lircd.conf")
+	assert.Equal(t, []RemoteConfig{{
+		Name:      "Sony_RM-ED035",
+		MinRepeat: 2,
+		Buttons: []Button{
+			{Code: 0xa90, Name: "KEY_POWER"},
+			{Code: 0x290, Name: "KEY_MUTE"},
+			{Code: 0x490, Name: "KEY_VOLUMEUP"},
+			{Code: 0xc90, Name: "KEY_VOLUMEDOWN"},
+		},
+	}}, remotes)
+
+	n, err := RemoteMinRepeat(remotes, "Sony_RM-ED035")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2), n)
+
+	_, err = RemoteMinRepeat(remotes, "missing")
+	assert.IsError(t, err, ErrUnknownRemote)
+
+	remotes = parse("testdata/remotes/samsung/BN59-00516A.lircd.conf")
+	assert.Equal(t, 5, len(remotes), "every remote is parsed")
+	n, err = RemoteMinRepeat(remotes, "Samsung_BN59-00516A_TV")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(0), n, "min_repeat defaults to 0")
+	assert.Equal(t, Button{Code: 0x40bf, Name: "KEY_POWER"}, remotes[0].Buttons[0])
+}
+
+func TestParseRemoteConfigMalformed(t *testing.T) {
+	for _, conf := range []string{
+		"name tv",
+		"begin remote\n  min_repeat lots\nend remote",
+		"begin remote\n  begin codes\n    KEY_POWER\n  end codes\nend remote",
+		"begin remote\n  name tv\n",
+		"begin remote\nend remote",
+	} {
+		_, err := ParseRemoteConfig(strings.NewReader(conf))
+		assert.IsError(t, err, ErrMalformedConfig, conf)
+	}
+}
+
+func TestFormatRawRemote(t *testing.T) {
+	us := func(n time.Duration) time.Duration { return n * time.Microsecond }
+	pulse := func(n time.Duration) PulseSpace { return PulseSpace{Pulse: true, Duration: us(n)} }
+	space := func(n time.Duration) PulseSpace { return PulseSpace{Duration: us(n)} }
+
+	conf, err := FormatRawRemote(RawRemote{
+		Name:      "learned",
+		Frequency: 38000,
+		Buttons: []RawButton{{
+			Name: "KEY_POWER",
+			Signal: []PulseSpace{
+				space(16777215),
+				pulse(4512), space(4471),
+				pulse(598), space(1671),
+				pulse(573), space(546),
+				pulse(601),
+				space(125012),
+			},
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `begin remote
+  name  learned
+  flags RAW_CODES
+  eps            30
+  aeps          100
+  frequency  38000
+  gap          100000
+
+  begin raw_codes
+    name KEY_POWER
+         4512    4471     598    1671     573     546
+          601
+
+  end raw_codes
+end remote
+`, conf)
+
+	remotes, err := ParseRemoteConfig(strings.NewReader(conf))
+	assert.NoError(t, err)
+	assert.Equal(t, []RemoteConfig{{Name: "learned"}}, remotes, "lircd.conf is well-formed")
+
+	for _, signal := range [][]PulseSpace{
+		nil,
+		{space(100)},
+		{pulse(100), pulse(100)},
+		{pulse(100), space(0), pulse(100)},
+	} {
+		_, err := FormatRawRemote(RawRemote{Name: "learned", Buttons: []RawButton{{Name: "KEY_POWER", Signal: signal}}})
+		assert.IsError(t, err, ErrInvalidSignal, "%v", signal)
+	}
+
+	_, err = FormatRawRemote(RawRemote{Name: "my remote"})
+	assert.IsError(t, err, ErrInvalidCommand)
+	_, err = FormatRawRemote(RawRemote{Name: "learned", Buttons: []RawButton{{Signal: []PulseSpace{pulse(100)}}}})
+	assert.IsError(t, err, ErrInvalidCommand)
+}
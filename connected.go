@@ -0,0 +1,124 @@
+package lirc
+
+import "context"
+
+// Connected returns whether the connection to lircd is currently established.
+func (l *Connection) Connected() bool {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+	return l.connected
+}
+
+// WaitConnected blocks until the connection to lircd is established or ctx is
+// done. It returns immediately if the connection is already established.
+func (l *Connection) WaitConnected(ctx context.Context) error {
+	l.stateMu.Lock()
+	up := l.up
+	l.stateMu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-up:
+		return nil
+	}
+}
+
+// stoppedContext is the context of connections that aren't started.
+var stoppedContext = func() context.Context {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(ErrNotConnected)
+	return ctx
+}()
+
+// Context returns the context that the connection's background work, such as
+// reconnecting and warming up, derives from. It is derived from the context
+// given to [Connection.Start] and canceled once Start returns, with the error
+// Start returned as its cause, or once [Connection.Close] stops a connection
+// started by [WithAutoStart]. Work tied to the connection's lifetime can derive
+// from it to stop along with the connection. If the connection isn't started,
+// the context is already canceled with [ErrNotConnected] as its cause.
+func (l *Connection) Context() context.Context {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+	return l.root
+}
+
+func (l *Connection) setRoot(ctx context.Context) {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+	l.root = ctx
+}
+
+func (l *Connection) setConnected(connected bool) {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+
+	if l.connected == connected {
+		return
+	}
+
+	l.connected = connected
+	now := l.opts.clock.Now()
+	if connected {
+		close(l.up)
+		if !l.lastDisconnect.IsZero() {
+			l.disconnectedTotal += now.Sub(l.lastDisconnect)
+		}
+	} else {
+		l.up = make(chan struct{})
+		l.lastDisconnect = now
+	}
+}
+
+// sendingStopped returns a channel that is closed once the current session
+// stops accepting commands.
+func (l *Connection) sendingStopped() <-chan struct{} {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+	return l.stopped
+}
+
+// stopSending unblocks the commands waiting to be sent in the current session
+// and starts a new one.
+func (l *Connection) stopSending() {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+
+	close(l.stopped)
+	l.stopped = make(chan struct{})
+}
+
+// reconnectStarted returns a channel that is closed while Start is
+// reestablishing a lost connection.
+func (l *Connection) reconnectStarted() <-chan struct{} {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+	return l.reconnecting
+}
+
+// startReconnecting marks the connection as being reestablished, which fails
+// the commands waiting to be sent with WithFailWhileReconnecting.
+func (l *Connection) startReconnecting() {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+
+	select {
+	case <-l.reconnecting:
+	default:
+		close(l.reconnecting)
+	}
+}
+
+// stopReconnecting marks the connection as no longer being reestablished,
+// either because a new session started or because Start returned.
+func (l *Connection) stopReconnecting() {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+
+	select {
+	case <-l.reconnecting:
+		l.reconnecting = make(chan struct{})
+	default:
+	}
+}
@@ -0,0 +1,80 @@
+package lirc
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/neilotoole/slogt"
+)
+
+func TestWaitConnected(t *testing.T) {
+	t.Run("already connected", func(t *testing.T) {
+		srv := newMockServer(t, mockSuccess)
+		conn := newConnection(srv.dial, nil)
+		ctx := startTestConnection(t, conn)
+
+		assert.NoError(t, conn.WaitConnected(ctx), "wait for connection")
+		assert.True(t, conn.Connected(), "connected")
+		assert.NoError(t, conn.WaitConnected(ctx), "already connected")
+	})
+
+	t.Run("racing startup", func(t *testing.T) {
+		srv := newMockServer(t, mockSuccess)
+		conn := newConnection(srv.dial, nil)
+		assert.False(t, conn.Connected(), "not connected before Start")
+
+		waitErr := make(chan error)
+		go func() { waitErr <- conn.WaitConnected(context.Background()) }()
+
+		ctx := startTestConnection(t, conn)
+		assert.NoError(t, <-waitErr, "wait for connection")
+		assert.True(t, conn.Connected(), "connected")
+
+		_, err := conn.SendCommand(ctx, Version{})
+		assert.NoError(t, err, "send after connecting")
+	})
+
+	t.Run("disconnected", func(t *testing.T) {
+		srv := newMockServer(t, mockSuccess)
+		conn := newConnection(srv.dial, nil)
+		ctx := startTestConnection(t, conn)
+		assert.NoError(t, conn.WaitConnected(ctx), "wait for connection")
+
+		srv.hangup()
+		eventually(t, func() bool { return !conn.Connected() }, "disconnect")
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		assert.IsError(t, conn.WaitConnected(ctx), context.DeadlineExceeded, "wait times out")
+	})
+}
+
+func TestContext(t *testing.T) {
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, []Option{
+		WithAutoStart(context.Background(), slogt.New(t)),
+		WithCoalescing(time.Hour),
+		WithIdleTimeout(time.Hour),
+	})
+	assert.IsError(t, context.Cause(conn.Context()), ErrNotConnected, "not started yet")
+
+	goroutines := runtime.NumGoroutine()
+
+	_, err := conn.SendCommand(context.Background(), Version{})
+	assert.NoError(t, err)
+
+	ctx := conn.Context()
+	assert.NoError(t, ctx.Err(), "connection is running")
+	assert.True(t, runtime.NumGoroutine() > goroutines, "background goroutines are running")
+
+	assert.NoError(t, conn.Close())
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context not canceled by Close")
+	}
+	eventually(t, func() bool { return runtime.NumGoroutine() <= goroutines }, "background goroutines stop")
+}
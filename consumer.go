@@ -0,0 +1,42 @@
+package lirc
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// consumerStallTimeout is how long an event may wait to be received before the
+// connection warns that nothing is reading its events.
+const consumerStallTimeout = 5 * time.Second
+
+// HasEventConsumer returns whether the events of the connection are being
+// received. It returns false once a button press has been waiting to be
+// received from [Connection.Events], or [Connection.ConnEvents], for 5
+// seconds, in which case a warning is logged, and true again once it is
+// received. Nothing else is read from lircd while a press waits, including the
+// replies to commands, so events must always be drained.
+func (l *Connection) HasEventConsumer() bool {
+	return !l.consumerStalled.Load()
+}
+
+// deliver sends v to ch, warning if nothing receives it for a while.
+func deliver[T any](ctx context.Context, l *Connection, logger *slog.Logger, ch chan<- T, v T) {
+	stall := l.opts.clock.NewTimer(consumerStallTimeout)
+	defer stall.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ch <- v:
+			l.consumerStalled.Store(false)
+			return
+		case <-stall.C():
+			l.consumerStalled.Store(true)
+			logger.Warn(
+				"button press has not been received, are events being read?",
+				"waited", consumerStallTimeout)
+		}
+	}
+}
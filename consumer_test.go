@@ -0,0 +1,29 @@
+package lirc
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestHasEventConsumer(t *testing.T) {
+	clock := newFakeClock()
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, []Option{withClock(clock)})
+
+	logs := newLogRecorder()
+	startTestConnectionLogger(t, conn, slog.New(logs))
+	assert.True(t, conn.HasEventConsumer(), "consumer is assumed before any event")
+
+	go srv.broadcast("00000000e0e040bf 00 KEY_POWER remote")
+	eventually(t, func() bool { return clock.HasTimer(consumerStallTimeout) }, "stalled event")
+	clock.Advance(consumerStallTimeout)
+
+	eventually(t, func() bool { return !conn.HasEventConsumer() }, "stall detection")
+	assert.Equal(t, 1, len(logs.find("button press has not been received, are events being read?")),
+		"stall is warned about")
+
+	<-conn.Events
+	eventually(t, conn.HasEventConsumer, "consumer is back")
+}
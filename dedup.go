@@ -0,0 +1,45 @@
+package lirc
+
+import (
+	"sync"
+	"time"
+)
+
+// dedupKey identifies a button press for WithDedup.
+type dedupKey struct {
+	remote, button string
+	code           uint64
+	repeat         uint
+}
+
+// dedup remembers the button presses delivered within the dedup window. It is
+// safe for concurrent use.
+type dedup struct {
+	mu   sync.Mutex
+	seen map[dedupKey]time.Time
+}
+
+// duplicate returns whether an identical event was seen less than window ago,
+// and otherwise remembers event as seen at now.
+func (d *dedup) duplicate(event ButtonPress, now time.Time, window time.Duration) bool {
+	key := dedupKey{event.RemoteControlName, event.ButtonName, event.Code, event.RepeatCount}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if at, ok := d.seen[key]; ok && now.Sub(at) < window {
+		return true
+	}
+
+	for k, at := range d.seen {
+		if now.Sub(at) >= window {
+			delete(d.seen, k)
+		}
+	}
+
+	if d.seen == nil {
+		d.seen = make(map[dedupKey]time.Time)
+	}
+	d.seen[key] = now
+	return false
+}
@@ -0,0 +1,59 @@
+package lirc
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// errorBuffer is the number of unread errors kept for Errors. Any more are
+// dropped.
+const errorBuffer = 16
+
+// ErrProtocol is matched by errors reported on [Connection.Errors] when lircd
+// sent something that doesn't follow the protocol.
+var ErrProtocol = errors.New("lirc: protocol error")
+
+// Errors matched by the error returned by [Connection.Start] when dialing
+// lircd fails for a common reason, along with the underlying error.
+var (
+	// ErrPermissionDenied is matched when the user is not allowed to connect
+	// to the lircd socket. Usually, the user has to be added to the group
+	// that owns the socket, such as lirc.
+	ErrPermissionDenied = errors.New("lirc: permission denied")
+	// ErrSocketNotFound is matched when the lircd socket doesn't exist, which
+	// usually means that lircd isn't running or uses another socket path.
+	ErrSocketNotFound = errors.New("lirc: socket not found")
+)
+
+// wrapDialError wraps an error from dialing lircd.
+func wrapDialError(err error) error {
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		return fmt.Errorf("cannot dial lircd connection: %w: %w", ErrPermissionDenied, err)
+	case errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("cannot dial lircd connection: %w: %w", ErrSocketNotFound, err)
+	default:
+		return fmt.Errorf("cannot dial lircd connection: %w", err)
+	}
+}
+
+// Errors returns a channel that receives errors as they happen on the
+// connection, so that supervising code doesn't have to wait for
+// [Connection.Start] to return: failing to dial, read or write, which end the
+// connection, as well as malformed lines from lircd, which don't. Malformed
+// lines are reported as often as they are logged; see [WithErrorLogThrottle].
+//
+// The channel is buffered and never closed. Errors are dropped while it's
+// full, so it's fine to never read from it.
+func (l *Connection) Errors() <-chan error {
+	return l.errs
+}
+
+// reportError sends err to the Errors channel unless it's full.
+func (l *Connection) reportError(err error) {
+	select {
+	case l.errs <- err:
+	default:
+	}
+}
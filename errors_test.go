@@ -0,0 +1,38 @@
+package lirc
+
+import (
+	"context"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/neilotoole/slogt"
+)
+
+func TestDialErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		errno syscall.Errno
+		err   error
+	}{
+		{"permission denied", syscall.EACCES, ErrPermissionDenied},
+		{"socket not found", syscall.ENOENT, ErrSocketNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dialErr := &net.OpError{
+				Op:  "dial",
+				Net: "unix",
+				Err: os.NewSyscallError("connect", test.errno),
+			}
+			conn := newConnection(func(context.Context) (net.Conn, error) { return nil, dialErr }, nil)
+
+			err := conn.Start(context.Background(), slogt.New(t))
+			assert.IsError(t, err, test.err, "typed error")
+			assert.IsError(t, err, test.errno, "underlying error is kept")
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package lirc
+
+import "sync"
+
+// history is a ring buffer of the last button presses, see WithHistory. It is
+// safe for concurrent use.
+type history struct {
+	mu     sync.Mutex
+	events []ButtonPress // capacity is the size of the ring
+	start  int           // index of the oldest event once events is full
+}
+
+// History returns the last button presses received, oldest first, as kept by
+// [WithHistory]. It returns nil if WithHistory isn't used.
+func (l *Connection) History() []ButtonPress {
+	return l.history.snapshot()
+}
+
+func (h *history) record(event ButtonPress) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch {
+	case cap(h.events) == 0:
+	case len(h.events) < cap(h.events):
+		h.events = append(h.events, event)
+	default:
+		h.events[h.start] = event
+		h.start = (h.start + 1) % len(h.events)
+	}
+}
+
+func (h *history) snapshot() []ButtonPress {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.events) == 0 {
+		return nil
+	}
+
+	events := make([]ButtonPress, 0, len(h.events))
+	events = append(events, h.events[h.start:]...)
+	events = append(events, h.events[:h.start]...)
+	return events
+}
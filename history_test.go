@@ -0,0 +1,31 @@
+package lirc
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestHistory(t *testing.T) {
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, []Option{WithHistory(3)})
+	startTestConnection(t, conn)
+
+	assert.Zero(t, conn.History(), "history is empty")
+
+	go srv.broadcast(
+		"00000000e0e040bf 00 KEY_POWER remote",
+		"00000000e0e040bf 01 KEY_POWER remote",
+		"00000000e0e040bf 02 KEY_POWER remote",
+		"00000000e0e040bf 03 KEY_POWER remote",
+		"00000000e0e040bf 04 KEY_POWER remote")
+	for range 5 {
+		<-conn.Events
+	}
+
+	var repeats []uint
+	for _, p := range conn.History() {
+		repeats = append(repeats, p.RepeatCount)
+	}
+	assert.Equal(t, []uint{2, 3, 4}, repeats, "most recent presses are kept in order")
+}
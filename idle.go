@@ -0,0 +1,48 @@
+package lirc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// ErrIdleTimeout is returned by [Connection.Start] when the connection was
+// closed by [WithIdleTimeout].
+var ErrIdleTimeout = errors.New("lirc: connection closed after being idle")
+
+// touch records activity on the connection for [WithIdleTimeout].
+func (l *Connection) touch() {
+	select {
+	case l.activity <- struct{}{}:
+	default:
+	}
+}
+
+// idleLoop cancels ctx with [ErrIdleTimeout] once the connection has been idle
+// for the duration set by WithIdleTimeout.
+func (l *Connection) idleLoop(ctx context.Context, logger *slog.Logger, cancel context.CancelCauseFunc) {
+	timeout := l.opts.clock.NewTimer(l.opts.idleTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-l.activity:
+			// Only this loop receives from the timer, so it's still pending if
+			// Stop fails.
+			if !timeout.Stop() {
+				<-timeout.C()
+			}
+			timeout.Reset(l.opts.idleTimeout)
+
+		case <-timeout.C():
+			logger.Debug(
+				"closing idle lircd connection",
+				"idle", l.opts.idleTimeout)
+			cancel(ErrIdleTimeout)
+			return
+		}
+	}
+}
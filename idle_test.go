@@ -0,0 +1,36 @@
+package lirc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/neilotoole/slogt"
+)
+
+func TestIdleTimeout(t *testing.T) {
+	const idle = time.Minute
+
+	clock := newFakeClock()
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, []Option{
+		withClock(clock),
+		WithAutoStart(context.Background(), slogt.New(t)),
+		WithIdleTimeout(idle),
+	})
+	t.Cleanup(func() { conn.Close() })
+
+	_, err := conn.SendCommand(context.Background(), Version{})
+	assert.NoError(t, err, "first command starts the connection")
+
+	eventually(t, func() bool { return len(conn.activity) == 0 && clock.HasTimer(idle) },
+		"idle timer to be armed after the last activity")
+	clock.Advance(idle)
+	eventually(t, func() bool { return !conn.Connected() }, "idle connection to be closed")
+
+	_, err = conn.SendCommand(context.Background(), Version{})
+	assert.NoError(t, err, "next command opens the connection again")
+	assert.True(t, conn.Connected(), "connected again")
+	assert.Equal(t, []string{"VERSION", "VERSION"}, srv.received(), "commands are sent")
+}
@@ -0,0 +1,106 @@
+package lirc
+
+import (
+	"slices"
+	"sync"
+)
+
+// inflight is the FIFO of commands that were written to lircd and are waiting
+// for their replies. lircd replies to commands in the order they were sent, so
+// the oldest command is always the one being replied to.
+type inflight struct {
+	mu       sync.Mutex
+	commands []*pendingCommand
+	depth    int
+	// freed is signaled whenever a command leaves the queue.
+	freed chan struct{}
+}
+
+func newInflight(depth int) *inflight {
+	return &inflight{
+		depth: max(depth, 1),
+		freed: make(chan struct{}, 1),
+	}
+}
+
+// full returns whether no more commands may be written until a reply arrives.
+func (f *inflight) full() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.commands) >= f.depth
+}
+
+// empty returns whether no command is waiting for its reply.
+func (f *inflight) empty() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.commands) == 0
+}
+
+func (f *inflight) push(pending *pendingCommand) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = append(f.commands, pending)
+}
+
+// front returns the oldest command without removing it, or nil if there is
+// none.
+func (f *inflight) front() *pendingCommand {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.commands) == 0 {
+		return nil
+	}
+	return f.commands[0]
+}
+
+// pop removes and returns the oldest command, or nil if there is none.
+func (f *inflight) pop() *pendingCommand {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.commands) == 0 {
+		return nil
+	}
+
+	pending := f.commands[0]
+	f.commands = f.commands[1:]
+	f.signalFreed()
+	return pending
+}
+
+// remove removes the given command, e.g. because it could not be written. It
+// returns false if the command was no longer in flight, such as because its
+// reply already arrived.
+func (f *inflight) remove(pending *pendingCommand) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	i := slices.Index(f.commands, pending)
+	if i == -1 {
+		return false
+	}
+	f.commands = slices.Delete(f.commands, i, i+1)
+	f.signalFreed()
+	return true
+}
+
+func (f *inflight) signalFreed() {
+	select {
+	case f.freed <- struct{}{}:
+	default:
+	}
+}
+
+// fail removes every command and sends them err.
+func (f *inflight) fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, pending := range f.commands {
+		pending.result <- commandResult{err: err}
+	}
+	f.commands = nil
+	f.signalFreed()
+}
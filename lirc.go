@@ -5,97 +5,495 @@ package lirc
 import (
 	"bufio"
 	"context"
-	"encoding/binary"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
+	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// Sender sends commands to lircd. [Connection] implements Sender, so code that
+// only needs to send commands can depend on it and be tested with a fake.
+type Sender interface {
+	SendCommand(ctx context.Context, command Command) (CommandReply, error)
+}
+
+// EventSource is a source of ButtonPress events. [Connection] implements
+// EventSource.
+type EventSource interface {
+	// ButtonPresses returns the channel that receives button presses.
+	ButtonPresses() <-chan ButtonPress
+}
+
+var (
+	_ Sender      = (*Connection)(nil)
+	_ EventSource = (*Connection)(nil)
+)
+
 // Connection is a connection to lircd.
 type Connection struct {
 	// Events is a channel that will receive ButtonPress events.
 	// These events are received asynchronously for as long as [Start] is
-	// running. This channel is never closed.
+	// running, in the order lircd sent them. This channel is never closed.
 	Events chan ButtonPress
 
-	send   chan Command
-	reply  chan CommandReply
+	// ConnEvents is a channel that will receive ButtonPress events along with
+	// the connection they came from. It is only created by [WithConnEvents], in
+	// which case events are sent on it instead of Events.
+	ConnEvents chan Event
+
+	send   chan *pendingCommand
 	dialer func(context.Context) (net.Conn, error)
+	opts   options
+
+	// sessionInflight is the inflight queue of the current session, if any,
+	// and writing is whether its sender goroutine took a command that isn't
+	// in flight yet. TrySendCommand uses them to tell whether the connection
+	// is busy.
+	sessionInflight atomic.Pointer[inflight]
+	writing         atomic.Bool
+
+	repeatsMu sync.Mutex
+	repeats   map[*Repeat]struct{}
+	// repeatsEnded counts the sessions whose repeats were ended, which tells
+	// RepeatButton whether the session that started a repeat is gone.
+	repeatsEnded uint64
+
+	stateMu   sync.Mutex
+	connected bool
+	up        chan struct{} // closed once connected
+	stopped   chan struct{} // closed once the current session stops sending
+	reloaded  chan struct{} // closed once lircd is reloaded
+	// reconnecting is closed while Start reestablishes a lost connection.
+	reconnecting chan struct{}
+	// root is the context of the running Start call; see Context.
+	root context.Context
+
+	lastDisconnect    time.Time
+	disconnectedTotal time.Duration // excluding the current disconnection
+
+	warmupMu sync.Mutex
+	version  string
+	catalog  map[string][]Button
+	// capabilities are derived from version; capabilitiesOK is false if it
+	// can't be parsed.
+	capabilities   Capabilities
+	capabilitiesOK bool
+
+	resyncRequested atomic.Bool // see Resync
+	commandLogMu    sync.Mutex  // see WithCommandLog
+
+	buttonCacheMu sync.Mutex
+	buttonCache   map[string][]Button // see NameToCode, cleared on reload
+
+	activity  chan struct{} // see touch
+	stats     connectionStats
+	rawFrames chan CommandReply // see ReadRawFrame
+	errs      chan error        // see Errors
+
+	seqMu          sync.Mutex // held while enqueueing, see SendOnceVia
+	transmittersMu sync.Mutex
+	transmitters   string // last mask set with SetTransmitters
+
+	autoMu  sync.Mutex
+	autoRun *autoRun
+	closed  bool
+
+	subsMu sync.Mutex
+	subs   map[*subscriber]struct{}
+	// subsBuffered is the number of events the buffers of subs can hold.
+	subsBuffered int
+
+	history history
+	dedup   dedup
+
+	consumerStalled atomic.Bool      // see HasEventConsumer
+	coalesce        chan ButtonPress // see coalesceLoop
 }
 
+// replyTimeout is how long SendCommand waits for lircd to reply to a command.
+const replyTimeout = 10 * time.Second
+
 // DefaultDialer is the default dialer used by NewUnix and NewTCP.
 var DefaultDialer = net.Dialer{}
 
 // NewUnix creates a new lirc connection that connects to lircd using a Unix
 // socket.
-// Connection will not be established; you must call Start to connect to lircd.
-func NewUnix(path string) *Connection {
-	return newRouter(func(ctx context.Context) (net.Conn, error) {
+// Connection will not be established; you must call Start to connect to lircd
+// unless [WithAutoStart] is used.
+func NewUnix(path string, opts ...Option) *Connection {
+	return newConnection(func(ctx context.Context) (net.Conn, error) {
 		return DefaultDialer.DialContext(ctx, "unix", path)
-	})
+	}, opts)
 }
 
 // NewTCP creates a new lirc connection that connects to lircd using a TCP
 // socket.
-// Connection will not be established; you must call Start to connect to lircd.
-func NewTCP(host string) *Connection {
-	return newRouter(func(ctx context.Context) (net.Conn, error) {
-		return DefaultDialer.DialContext(ctx, "tcp", host)
-	})
+// Connection will not be established; you must call Start to connect to lircd
+// unless [WithAutoStart] is used.
+func NewTCP(host string, opts ...Option) *Connection {
+	var c *Connection
+	c = newConnection(func(ctx context.Context) (net.Conn, error) {
+		conn, err := DefaultDialer.DialContext(ctx, "tcp", host)
+		if err != nil {
+			return nil, err
+		}
+
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			if err := configureTCP(tcpConn, &c.opts); err != nil {
+				conn.Close()
+				return nil, fmt.Errorf("cannot configure TCP connection: %w", err)
+			}
+		}
+
+		return conn, nil
+	}, opts)
+	return c
 }
 
-func newRouter(dialer func(ctx context.Context) (net.Conn, error)) *Connection {
-	return &Connection{
-		Events: make(chan ButtonPress),
-		send:   make(chan Command),
-		reply:  make(chan CommandReply),
-		dialer: dialer,
+// ErrCannotRedial is returned by [Connection.Start] when connecting again to
+// lircd through a connection created by [NewFromFD].
+var ErrCannotRedial = errors.New("lirc: connection from a file descriptor can't be reestablished")
+
+// NewFromFD creates a new lirc connection from the file descriptor of a socket
+// already connected to lircd, such as one passed by systemd socket activation.
+// NewFromFD takes ownership of fd and closes it, even if it fails.
+// The socket can only be used once: when the connection is lost, there is no
+// way to connect to lircd again, so [WithReconnect] and [WithAutoStart] can't
+// reestablish it and fail with [ErrCannotRedial].
+func NewFromFD(fd uintptr, opts ...Option) (*Connection, error) {
+	f := os.NewFile(fd, "lircd")
+	if f == nil {
+		return nil, fmt.Errorf("invalid file descriptor %d", fd)
 	}
+	// FileConn uses a duplicate of the file descriptor.
+	defer f.Close()
+	conn, err := net.FileConn(f)
+	if err != nil {
+		return nil, fmt.Errorf("cannot use file descriptor %d as a connection: %w", fd, err)
+	}
+
+	var mu sync.Mutex
+	return newConnection(func(context.Context) (net.Conn, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if conn == nil {
+			return nil, ErrCannotRedial
+		}
+		c := conn
+		conn = nil
+		return c, nil
+	}, opts), nil
 }
 
-// SendCommand sends a command to lirc daemon.
-func (l *Connection) SendCommand(ctx context.Context, command Command) (CommandReply, error) {
-	select {
-	case <-ctx.Done():
-		return CommandReply{}, fmt.Errorf("error sending command: %w", ctx.Err())
-	case l.send <- command:
-		// safe to continue
+func configureTCP(conn *net.TCPConn, opts *options) error {
+	if err := conn.SetNoDelay(opts.tcpNoDelay); err != nil {
+		return err
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
+	if opts.tcpKeepAlive < 0 {
+		return conn.SetKeepAlive(false)
+	}
 
-	select {
-	case <-ctx.Done():
-		return CommandReply{}, fmt.Errorf("error waiting for reply: %w", ctx.Err())
-	case reply := <-l.reply:
-		if reply.Command != command.EncodeCommand()[0] {
-			return reply, fmt.Errorf("unexpected reply command: %q", reply.Command)
+	if err := conn.SetKeepAlive(true); err != nil {
+		return err
+	}
+	return conn.SetKeepAlivePeriod(opts.tcpKeepAlive)
+}
+
+func newConnection(dialer func(ctx context.Context) (net.Conn, error), opts []Option) *Connection {
+	c := &Connection{
+		Events:  make(chan ButtonPress),
+		send:    make(chan *pendingCommand),
+		dialer:  dialer,
+		opts:    defaultOptions(),
+		repeats: make(map[*Repeat]struct{}),
+		up:      make(chan struct{}),
+		stopped: make(chan struct{}),
+
+		reconnecting: make(chan struct{}),
+		root:         stoppedContext,
+
+		reloaded:  make(chan struct{}),
+		activity:  make(chan struct{}, 1),
+		rawFrames: make(chan CommandReply, rawFrameBuffer),
+		errs:      make(chan error, errorBuffer),
+	}
+	for _, opt := range opts {
+		opt(&c.opts)
+	}
+	if c.opts.connEvents {
+		c.ConnEvents = make(chan Event)
+	}
+	if c.opts.coalesceWindow > 0 {
+		c.coalesce = make(chan ButtonPress)
+	}
+	if c.opts.historySize > 0 {
+		c.history.events = make([]ButtonPress, 0, c.opts.historySize)
+	}
+	return c
+}
+
+// ButtonPresses implements the [EventSource] interface. It returns Events.
+func (l *Connection) ButtonPresses() <-chan ButtonPress {
+	return l.Events
+}
+
+// deliverEvent delivers a ButtonPress parsed by the reader to the user.
+func (l *Connection) deliverEvent(ctx context.Context, logger *slog.Logger, event ButtonPress) {
+	now := l.opts.clock.Now()
+	l.stats.countEvent(event, now)
+
+	if l.opts.eventTap != nil {
+		select {
+		case l.opts.eventTap <- event:
+		default:
+			logger.Debug(
+				"event tap is full, dropping button press",
+				"button", event.ButtonName)
+		}
+	}
+
+	if w := l.opts.dedupWindow; w > 0 && l.dedup.duplicate(event, now, w) {
+		return
+	}
+
+	if n := l.opts.repeatFilter; n > 1 && event.RepeatCount%n != 0 {
+		return
+	}
+
+	l.history.record(event)
+	l.publish(event)
+
+	if l.coalesce != nil {
+		select {
+		case <-ctx.Done():
+		case l.coalesce <- event:
 		}
-		if !reply.Success {
-			return reply, ErrUnsuccessfulCommand
+		return
+	}
+	l.emitEvent(ctx, logger, event)
+}
+
+// emitEvent sends event on Events, or ConnEvents if enabled.
+func (l *Connection) emitEvent(ctx context.Context, logger *slog.Logger, event ButtonPress) {
+	if l.ConnEvents != nil {
+		deliver(ctx, l, logger, l.ConnEvents, Event{event, l})
+		return
+	}
+	deliver(ctx, l, logger, l.Events, event)
+}
+
+// pendingCommand is a command handed to the sender goroutine by SendCommand.
+type pendingCommand struct {
+	command Command
+	raw     []byte // written as-is instead of command, see WriteRaw
+	sentAt  time.Time
+	// result receives the outcome of the command. It is buffered so that the
+	// sender goroutine never blocks on it.
+	result chan commandResult
+	// feed optionally receives each DATA line of the reply as it arrives.
+	feed chan string
+	// done is closed once the caller stops waiting for the command.
+	done chan struct{}
+
+	partialMu sync.Mutex
+	partial   []string // DATA lines received so far
+}
+
+// setPartial records the DATA lines of the reply received so far.
+func (p *pendingCommand) setPartial(data []string) {
+	p.partialMu.Lock()
+	defer p.partialMu.Unlock()
+	p.partial = data
+}
+
+// wrapPartial wraps err in a [PartialReplyError] if part of the reply was
+// already received.
+func (p *pendingCommand) wrapPartial(err error) error {
+	p.partialMu.Lock()
+	defer p.partialMu.Unlock()
+
+	if len(p.partial) == 0 {
+		return err
+	}
+	return &PartialReplyError{
+		Command: p.command.EncodeCommand()[0],
+		Data:    slices.Clone(p.partial),
+		Err:     err,
+	}
+}
+
+type commandResult struct {
+	reply CommandReply
+	err   error
+}
+
+// SendCommand sends a command to lirc daemon. If it is called before Start,
+// or while Start reconnects, it waits for the connection to be established,
+// unless [WithFailWhileReconnecting] is used. It fails with
+// [ErrNotConnected] if the connection is closed before the reply arrives.
+// Invalid commands fail with [ErrInvalidCommand] without being sent; see
+// [Connection.DryEncode]. Idempotent commands are retried as configured by
+// [WithRetries].
+func (l *Connection) SendCommand(ctx context.Context, command Command) (CommandReply, error) {
+	return l.sendCommandRetry(ctx, command, l.enqueueNext)
+}
+
+// sendCommand sends a command to lircd. If stream is not nil, each DATA line
+// of the reply is also sent to it as soon as it's received.
+func (l *Connection) sendCommand(ctx context.Context, command Command, stream chan<- string) (CommandReply, error) {
+	return l.sendCommandWith(ctx, command, stream, l.enqueueNext)
+}
+
+// sendCommandWith is sendCommand, but the command is handed to the sender
+// goroutine by enqueue.
+func (l *Connection) sendCommandWith(ctx context.Context, command Command, stream chan<- string, enqueue func(context.Context, *pendingCommand) error) (CommandReply, error) {
+	command, err := l.prepareCommand(command)
+	if err != nil {
+		return CommandReply{}, err
+	}
+
+	pending := &pendingCommand{
+		command: command,
+		result:  make(chan commandResult, 1),
+		done:    make(chan struct{}),
+	}
+	defer close(pending.done)
+
+	if stream != nil {
+		pending.feed = make(chan string)
+	}
+
+	if err := enqueue(ctx, pending); err != nil {
+		return CommandReply{}, err
+	}
+
+	timeout := l.opts.clock.NewTimer(replyTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return CommandReply{}, pending.wrapPartial(fmt.Errorf("error waiting for reply: %w", ctx.Err()))
+		case <-timeout.C():
+			return CommandReply{}, pending.wrapPartial(fmt.Errorf("error waiting for reply: %w: %w", ErrReplyTimeout, context.DeadlineExceeded))
+		case line := <-pending.feed:
+			select {
+			case <-ctx.Done():
+				return CommandReply{}, fmt.Errorf("error streaming reply: %w", ctx.Err())
+			case stream <- line:
+			}
+		case result := <-pending.result:
+			if result.err != nil {
+				return CommandReply{}, result.err
+			}
+
+			reply := result.reply
+			// Proxies may echo the prefix back along with the command.
+			echoed := reply.Command
+			if len(l.opts.commandPrefix) > 0 {
+				echoed = strings.TrimPrefix(echoed, strings.Join(l.opts.commandPrefix, " ")+" ")
+			}
+			if !l.opts.replyMatcher(command, echoed) {
+				return reply, fmt.Errorf("unexpected reply command: %q", reply.Command)
+			}
+			if !reply.Success {
+				return reply, newCommandError(reply)
+			}
+			if st, ok := command.(SetTransmitters); ok {
+				l.setTransmitters(st.TransmitterMask)
+			}
+			return reply, nil
 		}
-		return reply, nil
 	}
 }
 
-// RepeatButton tells lircd to keep sending the given button until the returned
-// callback is called.
-func (l *Connection) RepeatButton(ctx context.Context, remote, button string) (stop func(), err error) {
-	if _, err := l.SendCommand(ctx, SendStart{remote, button}); err != nil {
+// prepareCommand checks that command may be sent on the connection and
+// returns it as it is sent, with the defaults set by the options filled in.
+func (l *Connection) prepareCommand(command Command) (Command, error) {
+	command = unwrapCommand(command)
+
+	if l.opts.receiveOnly {
+		return nil, ErrSendDisabled
+	}
+
+	validate := validateCommand
+	if encode := l.opts.commandEncoder; encode != nil {
+		validate = func(command Command) error { return validateEncoded(command, encode) }
+	}
+	if err := validate(command); err != nil {
 		return nil, err
 	}
 
-	return func() {
-		l.SendCommand(ctx, SendStop{remote, button})
-	}, nil
+	if err := validatePrefix(l.opts.commandPrefix); err != nil {
+		return nil, err
+	}
+
+	if err := l.checkAllowedRemote(command); err != nil {
+		return nil, err
+	}
+
+	if sendOnce, ok := command.(SendOnce); ok && sendOnce.Repeats == 0 {
+		sendOnce.Repeats = l.opts.defaultRepeats
+		command = sendOnce
+	}
+
+	return command, nil
+}
+
+// matchReplyVerb is the default reply matcher. lircd echoes the whole command
+// line in its reply, so only the verbs are compared, ignoring case and
+// surrounding whitespace.
+func matchReplyVerb(command Command, echoed string) bool {
+	fields := strings.Fields(echoed)
+	return len(fields) > 0 && strings.EqualFold(fields[0], command.EncodeCommand()[0])
+}
+
+// enqueueNext is enqueue, but it waits for the sequence of commands being sent
+// by another caller, if any, to be done; see SendOnceVia.
+func (l *Connection) enqueueNext(ctx context.Context, pending *pendingCommand) error {
+	// Start the connection without holding seqMu, so that other callers
+	// aren't held up meanwhile.
+	if l.opts.autoStart != nil {
+		if err := l.autoStart(ctx); err != nil {
+			return err
+		}
+	}
+
+	l.seqMu.Lock()
+	defer l.seqMu.Unlock()
+	return l.enqueue(ctx, pending)
+}
+
+// enqueue hands pending to the sender goroutine. It doesn't start the
+// connection with WithAutoStart: callers do that before taking seqMu, which
+// they must hold, so that a slow dial doesn't hold up every other caller. The
+// warmup doesn't, since it runs before the session counts as connected.
+func (l *Connection) enqueue(ctx context.Context, pending *pendingCommand) error {
+	var reconnecting <-chan struct{}
+	if l.opts.failWhileReconnecting {
+		reconnecting = l.reconnectStarted()
+	}
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("error sending command: %w", ctx.Err())
+	case <-l.sendingStopped():
+		return ErrNotConnected
+	case <-reconnecting:
+		return ErrReconnecting
+	case l.send <- pending:
+		return nil
+	}
 }
 
 type connectionState uint
@@ -109,6 +507,7 @@ const (
 	stateDataLength
 	stateData
 	stateDataEnd
+	stateDataDiscard
 )
 
 func (s connectionState) String() string {
@@ -129,29 +528,139 @@ func (s connectionState) String() string {
 		return "data"
 	case stateDataEnd:
 		return "data end"
+	case stateDataDiscard:
+		return "data discard"
 	default:
 		return "unknown"
 	}
 }
 
+// Resync makes the connection stop parsing the reply it is reading from lircd,
+// if any, and read the next line as a button press or the start of a new
+// reply. It is a way to recover from a reply that lircd or a proxy garbled
+// without reconnecting. The command whose reply is abandoned fails with
+// [ErrReplyLost]. Resync takes effect when the next line is received, and the
+// reply isn't abandoned if that line is the END that completes it.
+func (l *Connection) Resync() {
+	l.resyncRequested.Store(true)
+}
+
 // Start starts the lirc connection. It blocks until the connection is closed or
-// ctx is done.
-func (r *Connection) Start(ctx context.Context, logger *slog.Logger) error {
+// ctx is done. With [WithReconnect], it instead connects again whenever the
+// connection is lost, until ctx is done or [WithMaxConnectAttempts] is reached.
+// See also [WithReconnectGrace]. Everything the connection runs in the
+// background derives from a context that is canceled once Start returns; see
+// [Connection.Context].
+func (r *Connection) Start(ctx context.Context, logger *slog.Logger) (err error) {
+	// failed holds the errors of the connect attempts that failed in a row.
+	var failed []error
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	r.setRoot(ctx)
+	defer func() { cancel(err) }()
+
+	defer r.stopReconnecting()
+
+	conn, err := r.dial(ctx)
+	for {
+		if err == nil {
+			failed = nil
+			err = r.session(ctx, logger, conn)
+			if (r.opts.reconnectGrace > 0 || r.opts.reconnectDelay > 0) && ctx.Err() == nil && !errors.Is(err, ErrIdleTimeout) {
+				r.startReconnecting()
+			}
+			if r.opts.reconnectGrace > 0 && ctx.Err() == nil && !errors.Is(err, ErrIdleTimeout) {
+				if conn, err = r.redial(ctx); err == nil {
+					logger.Info("reconnected to lircd within the grace period")
+					continue
+				}
+				failed = append(failed, err)
+			}
+		} else {
+			failed = append(failed, err)
+		}
+
+		if r.opts.reconnectDelay <= 0 || ctx.Err() != nil || errors.Is(err, ErrIdleTimeout) {
+			return err
+		}
+
+		if n := r.opts.maxConnectAttempts; n > 0 && len(failed) >= n {
+			return connectAttemptsError(failed)
+		}
+
+		logger.Warn(
+			"lircd connection lost, reconnecting",
+			"err", err,
+			"delay", r.opts.reconnectDelay)
+
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-r.opts.clock.After(r.opts.reconnectDelay):
+		}
+
+		conn, err = r.dial(ctx)
+	}
+}
+
+// dial connects to lircd.
+func (r *Connection) dial(ctx context.Context) (net.Conn, error) {
 	conn, err := r.dialer(ctx)
 	if err != nil {
-		return fmt.Errorf("cannot dial lircd connection: %w", err)
+		err = wrapDialError(err)
+		r.reportError(err)
+		return nil, err
 	}
+	return conn, nil
+}
 
+// session serves the connection to lircd until it is lost or ctx is done.
+func (r *Connection) session(ctx context.Context, logger *slog.Logger, conn net.Conn) error {
 	logger = logger.With("connection", conn.RemoteAddr().String())
 
-	repliesCh := make(chan CommandReply)
-	sendingCh := r.send
+	// The connection is back, so commands such as the warmup's may be sent
+	// again, even before the session counts as connected.
+	r.stopReconnecting()
+
+	var inflight *inflight
+	if !r.opts.receiveOnly {
+		inflight = newInflight(r.opts.pipelineDepth)
+		// Commands that are still waiting for a reply won't get one once the
+		// connection is gone. This runs after every goroutine below is done.
+		defer inflight.fail(ErrNotConnected)
+
+		r.sessionInflight.Store(inflight)
+		defer r.sessionInflight.Store(nil)
+	}
 
-	reader := newLircReader(logger, r.Events, repliesCh)
+	reader := newLircReader(logger, &r.opts, func(ctx context.Context, event ButtonPress) {
+		r.deliverEvent(ctx, logger, event)
+	}, inflight)
+	reader.lineRead = r.touch
+	reader.reloaded = r.notifyReload
+	reader.reportError = r.reportError
+	reader.resyncRequested = func() bool { return r.resyncRequested.Swap(false) }
+	if r.opts.commandLog != nil {
+		reader.replied = r.logReply
+	}
+	if !r.opts.receiveOnly {
+		reader.unclaimed = func(_ context.Context, reply CommandReply) {
+			select {
+			case r.rawFrames <- reply:
+			default:
+				logger.Warn(
+					"received reply with no command in flight, dropping",
+					"command", reply.Command)
+			}
+		}
+	}
 
 	var wg sync.WaitGroup
 	defer wg.Wait()
 
+	// lircd stops repeating once the connection is gone.
+	defer r.endRepeats()
+
 	ctx, cancel := context.WithCancelCause(ctx)
 
 	wg.Add(1)
@@ -159,193 +668,489 @@ func (r *Connection) Start(ctx context.Context, logger *slog.Logger) error {
 		defer wg.Done()
 		defer cancel(nil)
 
-		scanner := bufio.NewScanner(conn)
-		for scanner.Scan() {
-			line := scanner.Text()
-			logger.Debug("received line from lircd", "line", line)
-			reader.read(ctx, line)
-		}
-
-		if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		if err := reader.pump(ctx, conn); err != nil {
 			logger.Error(
 				"error reading from lircd socket",
 				"err", err)
+			r.reportError(fmt.Errorf("error reading from lircd socket: %w", err))
 			cancel(err)
 		}
 	}()
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		defer cancel(nil)
+	// Receive-only connections never write, so they don't need a sender.
+	if !r.opts.receiveOnly {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer r.stopSending()
+			cancel(r.sendLoop(ctx, logger, conn, inflight))
+		}()
+	}
 
-		var cmd Command
-		var receivedTime time.Time
-		for {
-			select {
-			case <-ctx.Done():
-				return
+	if r.coalesce != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.coalesceLoop(ctx, logger)
+		}()
+	}
 
-			case cmd = <-sendingCh:
-				// Prevent the user from sending any other commands until we've
-				// received the reply for this one.
-				sendingCh = nil
+	if r.opts.idleTimeout > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.idleLoop(ctx, logger, cancel)
+		}()
+	}
 
-				receivedTime = time.Now()
+	if r.opts.warmup && !r.opts.receiveOnly {
+		if retry := r.warmup(ctx, logger); retry != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				retry()
+			}()
+		}
+	}
+
+	r.setConnected(true)
+	<-ctx.Done()
+	r.setConnected(false)
 
-				encoded := cmd.EncodeCommand()
-				raw := strings.Join(encoded, " ") + "\n"
+	if err := conn.Close(); err != nil {
+		return fmt.Errorf("error closing lircd connection: %w", err)
+	}
 
-				logger.Debug(
-					"sending command to lircd",
-					"command", encoded[0])
+	wg.Wait()
+	return context.Cause(ctx)
+}
 
-				if _, err := io.WriteString(conn, raw); err != nil {
-					logger.Error(
-						"error writing to lircd socket",
-						"err", err)
-					cancel(err)
-					return
-				}
+// sendLoop writes commands from SendCommand to conn until ctx is done or
+// writing fails. The reader hands the replies back through inflight.
+func (r *Connection) sendLoop(ctx context.Context, logger *slog.Logger, conn net.Conn, inflight *inflight) error {
+	defer r.writing.Store(false)
 
-			case reply := <-repliesCh:
-				if reply.Command == "SIGHUP" {
-					logger.InfoContext(ctx, "lircd has been reloaded")
-					continue
-				}
+	for {
+		r.writing.Store(false)
 
-				logger.Debug(
-					"received reply from lircd",
-					"command", reply.Command)
+		sendingCh := r.send
+		if inflight.full() {
+			// Prevent the user from sending any other commands until we've
+			// received a reply for the ones in flight.
+			sendingCh = nil
+		}
 
-				select {
-				case <-ctx.Done():
-					return
-				case r.reply <- reply:
-					// Reinstate the ability to send commands.
-					sendingCh = r.send
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-inflight.freed:
+			// Reinstate the ability to send commands.
+
+		case pending := <-sendingCh:
+			r.writing.Store(true)
+			r.touch()
+
+			select {
+			case <-pending.done:
+				// The caller stopped waiting before the command was written,
+				// so don't send it at all.
+				logger.Debug("command abandoned before being sent, skipping")
+				continue
+			default:
+			}
+			if pending.raw != nil {
+				err := r.writeRaw(logger, conn, pending)
+				r.writing.Store(false)
+				if err != nil {
+					r.reportError(err)
+					return err
 				}
+				continue
+			}
+
+			pending.sentAt = r.opts.clock.Now()
+			inflight.push(pending)
+			// The command is in flight now, which is what tells that the
+			// connection is busy until its reply arrives.
+			r.writing.Store(false)
+
+			encoded := pending.command.EncodeCommand()
+			raw := encodeCommand(pending.command, r.opts.commandEncoder, r.opts.commandPrefix...)
+
+			logger.Debug(
+				"sending command to lircd",
+				"command", encoded[0])
 
-				took := time.Since(receivedTime)
-				logger.Debug(
-					"command roundtrip time",
-					"command", reply.Command,
-					"took", took)
+			// The reply may be read as soon as the command is written, so log
+			// the command first.
+			if r.opts.commandLog != nil {
+				r.logCommand(pending.sentAt, raw)
 			}
-		}
-	}()
+			// Same for the stats, so that they count the command by the time
+			// its caller has the reply.
+			r.stats.countCommand(pending.sentAt)
 
-	<-ctx.Done()
+			if err := r.write(conn, []byte(raw)); err != nil {
+				logger.Error(
+					"error writing to lircd socket",
+					"err", err)
 
-	if err := conn.Close(); err != nil {
-		return fmt.Errorf("error closing lircd connection: %w", err)
+				err = fmt.Errorf("error writing command: %w", err)
+				r.reportError(err)
+				// The reply may have been read while the command was being
+				// written, in which case the command already has its result.
+				if inflight.remove(pending) {
+					pending.result <- commandResult{err: err}
+				}
+				return err
+			}
+		}
 	}
+}
 
-	wg.Wait()
-	return context.Cause(ctx)
+// write writes b to conn, failing if it takes longer than the write timeout.
+// If it fails, lircd may have received part of b and would misparse whatever
+// follows it, so the connection must not be written to again.
+func (r *Connection) write(conn net.Conn, b []byte) error {
+	if d := r.opts.writeTimeout; d > 0 {
+		// Deadlines are in wall time, so the connection's clock isn't used.
+		if err := conn.SetWriteDeadline(time.Now().Add(d)); err != nil {
+			return err
+		}
+	}
+
+	n, err := conn.Write(b)
+	if err != nil && n > 0 {
+		return fmt.Errorf("wrote %d of %d bytes: %w", n, len(b), err)
+	}
+	return err
 }
 
+const (
+	// maxDataLength is the largest DATA length accepted in a reply.
+	maxDataLength = 1 << 20
+	// maxDataPrealloc is the largest number of DATA lines allocated before
+	// they are received.
+	maxDataPrealloc = 64
+)
+
 type lircReader struct {
 	state      connectionState
 	reply      CommandReply
 	dataCount  int
 	dataLength int
 
-	logger  *slog.Logger
-	events  chan<- ButtonPress
-	replies chan<- CommandReply
+	logger   *slog.Logger
+	opts     *options
+	events   func(context.Context, ButtonPress)
+	inflight *inflight
+	// The following are called, if not nil: unclaimed with replies to no
+	// command, lineRead for every line, reloaded on SIGHUP and reportError
+	// with every logged error.
+	unclaimed   func(context.Context, CommandReply)
+	lineRead    func()
+	reloaded    func()
+	reportError func(error)
+	// replied is called with every reply but SIGHUP broadcasts.
+	replied func(CommandReply)
+	// resyncRequested returns whether Resync was called since it last
+	// returned true.
+	resyncRequested func() bool
+
+	errorLogs map[string]throttledLog
 }
 
-func newLircReader(logger *slog.Logger, events chan<- ButtonPress, replies chan<- CommandReply) *lircReader {
+// throttledLog tracks an error message that is logged at most once per
+// throttle window.
+type throttledLog struct {
+	since      time.Time
+	suppressed int
+}
+
+func newLircReader(logger *slog.Logger, opts *options, events func(context.Context, ButtonPress), inflight *inflight) *lircReader {
 	return &lircReader{
-		state:   stateReceive,
-		logger:  logger,
-		events:  events,
-		replies: replies,
+		state:    stateReceive,
+		logger:   logger,
+		opts:     opts,
+		events:   events,
+		inflight: inflight,
+
+		errorLogs: make(map[string]throttledLog),
 	}
 }
 
+// pump reads lines from rd and feeds them to the reader until rd is closed or
+// reading fails.
+func (r *lircReader) pump(ctx context.Context, rd io.Reader) error {
+	scanner := bufio.NewScanner(rd)
+	scanner.Split(r.opts.splitFunc)
+	for scanner.Scan() {
+		line := scanner.Text()
+		r.logger.Debug("received line from lircd", "line", line)
+		if r.lineRead != nil {
+			r.lineRead()
+		}
+		r.read(ctx, line)
+	}
+
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
 func (r *lircReader) setState(state connectionState) {
 	r.state = state
 	r.logger.Debug("lirc reader state changed", "state", state)
 }
 
 func (r *lircReader) stateError(err string, attrs ...any) {
+	r.setState(stateReceive)
+
+	if window := r.opts.errorLogThrottle; window > 0 {
+		now := r.opts.clock.Now()
+
+		last, ok := r.errorLogs[err]
+		if ok && now.Sub(last.since) < window {
+			last.suppressed++
+			r.errorLogs[err] = last
+			return
+		}
+
+		if last.suppressed > 0 {
+			attrs = append(attrs,
+				"suppressed", last.suppressed,
+				"window", window)
+		}
+
+		r.errorLogs[err] = throttledLog{since: now}
+	}
+
 	r.logger.
 		With("err", err).
 		Error("lirc error", attrs...)
-	r.setState(stateReceive)
+
+	if r.reportError != nil {
+		r.reportError(fmt.Errorf("%w: %s", ErrProtocol, err))
+	}
+}
+
+// replyError is stateError for a malformed reply, which also fails the
+// command being replied to.
+func (r *lircReader) replyError(err string, attrs ...any) {
+	r.failReply(fmt.Errorf("%w: %w: %s", ErrProtocol, ErrReplyLost, err))
+	r.stateError(err, attrs...)
 }
 
 func (r *lircReader) flushReply(ctx context.Context) {
-	select {
-	case <-ctx.Done():
-		r.logger.Warn(
-			"context done, dropping reply",
-			"err", ctx.Err(),
-			"command", r.reply.Command)
-	case r.replies <- r.reply:
+	if r.reply.Command == "SIGHUP" {
+		// lircd broadcasts SIGHUP to every client when it's reloaded. This is
+		// not a reply to any command, so don't deliver it.
+		r.logger.Log(ctx, r.opts.reloadLogLevel, "lircd has been reloaded")
+		if r.reloaded != nil {
+			r.reloaded()
+		}
+		return
+	}
+
+	if r.replied != nil {
+		r.replied(r.reply)
+	}
+
+	if r.inflight == nil && r.unclaimed == nil {
 		r.logger.Debug(
-			"delivered reply back to event loop",
+			"receive-only connection, dropping reply",
 			"command", r.reply.Command)
+		return
 	}
+
+	var pending *pendingCommand
+	if r.inflight != nil {
+		pending = r.inflight.pop()
+	}
+	if pending == nil {
+		if r.unclaimed != nil {
+			r.unclaimed(ctx, r.reply)
+			return
+		}
+		r.logger.Warn(
+			"received reply with no command in flight, dropping",
+			"command", r.reply.Command)
+		return
+	}
+
+	// result is buffered, so the reply is delivered without blocking even if
+	// the caller stopped waiting for it or the connection is shutting down
+	// and the caller has yet to receive it. Either way, the next command can
+	// be sent right away.
+	pending.result <- commandResult{reply: r.reply}
+
+	took := r.opts.clock.Now().Sub(pending.sentAt)
+	r.logger.Debug(
+		"delivered reply",
+		"command", r.reply.Command,
+		"took", took)
 }
 
-func (r *lircReader) read(ctx context.Context, line string) {
-	switch r.state {
-	case stateReceive:
-		if line == "BEGIN" {
-			r.setState(stateReply)
+// loseReply fails the command whose reply was interrupted with ErrReplyLost.
+func (r *lircReader) loseReply() {
+	r.logger.Warn(
+		"lirc reply interrupted by a new reply",
+		"state", r.state,
+		"command", r.reply.Command)
 
-			r.reply = CommandReply{}
-			r.dataCount = 0
-			r.dataLength = 0
+	// Before the command line is read, there is no telling whether the reply
+	// was meant for a command at all. The command was already failed if its
+	// reply was being discarded.
+	if r.state == stateReply || r.state == stateDataDiscard || r.reply.Command == "SIGHUP" || r.inflight == nil {
+		return
+	}
 
-			return
+	if pending := r.inflight.pop(); pending != nil {
+		pending.result <- commandResult{err: ErrReplyLost}
+	}
+}
+
+// resync puts the reader back in stateReceive as requested by Resync, unless
+// line completes the reply being read. It returns whether line is still to be
+// read.
+func (r *lircReader) resync(line string) bool {
+	switch {
+	case r.state == stateReceive, line == "BEGIN":
+		// Either there's nothing to resynchronize or the new reply takes care
+		// of it.
+		return true
+	case line == "END" && (r.state == stateStatus || r.state == stateDataStart || r.state == stateDataEnd):
+		// The reply is only missing its END, so let it complete.
+		return true
+	case line == "END" && r.state == stateDataDiscard && r.dataCount >= r.dataLength:
+		return true
+	}
+
+	r.logger.Warn(
+		"resynchronizing lirc reader",
+		"state", r.state,
+		"command", r.reply.Command)
+
+	// The command was already failed if its reply was being discarded.
+	if r.state != stateReply && r.state != stateDataDiscard && r.reply.Command != "SIGHUP" && r.inflight != nil {
+		if pending := r.inflight.pop(); pending != nil {
+			pending.result <- commandResult{err: ErrReplyLost}
 		}
+	}
+
+	r.setState(stateReceive)
+
+	// END can only have been meant to end the abandoned reply.
+	return line != "END"
+}
+
+// discardReply fails the command being replied to with err and skips the rest
+// of the reply.
+func (r *lircReader) discardReply(err error) {
+	r.logger.Warn(
+		"discarding lirc reply",
+		"command", r.reply.Command,
+		"err", err)
+
+	r.failReply(err)
+
+	r.reply.Data = nil
+	r.dataCount = 0
+	r.setState(stateDataDiscard)
+}
+
+// failReply fails the command being replied to with err. lircd replies to
+// commands in order, so that is the command at the front of the inflight
+// queue. Without this, the command would wait out its timeout, and the
+// commands after it wouldn't be sent while the queue is full.
+func (r *lircReader) failReply(err error) {
+	if r.inflight == nil || r.reply.Command == "SIGHUP" {
+		return
+	}
+	if pending := r.inflight.pop(); pending != nil {
+		pending.result <- commandResult{err: err}
+	}
+}
+
+// feedData records a DATA line as part of the reply to the command being
+// replied to, and forwards it if the command asked for its reply to be
+// streamed.
+func (r *lircReader) feedData(ctx context.Context, line string) {
+	if r.inflight == nil {
+		return
+	}
+
+	pending := r.inflight.front()
+	if pending == nil {
+		return
+	}
+
+	pending.setPartial(r.reply.Data)
+	if pending.feed == nil {
+		return
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-pending.done:
+	case pending.feed <- line:
+	}
+}
+
+func (r *lircReader) read(ctx context.Context, line string) {
+	if r.resyncRequested != nil && r.resyncRequested() && !r.resync(line) {
+		return
+	}
 
-		w := strings.Split(line, " ")
-		h := w[0]
-		if len(h) < 16 {
-			h = strings.Repeat("0", 16-len(h)) + h
+	if line == "BEGIN" {
+		if r.state != stateReceive {
+			// The previous reply never got its END. Resynchronize on this new
+			// reply instead of misparsing it as part of the previous one.
+			r.loseReply()
 		}
 
-		c, err := hex.DecodeString(h)
+		r.setState(stateReply)
+
+		r.reply = CommandReply{}
+		r.dataCount = 0
+		r.dataLength = 0
+
+		return
+	}
+
+	switch r.state {
+	case stateReceive:
+		event, err := parseBroadcast(line, r.opts.codeWidth)
 		if err != nil {
 			r.stateError(
-				"lirc code not parseable as hex",
-				"len", len(h))
+				"lirc event not parseable",
+				"reason", err)
 			return
 		}
-		if len(c) != 8 {
-			r.stateError(
-				"lirc code has wrong length for 16-bit integer",
-				"len", len(c))
-			return
+		if r.opts.rawEvents {
+			event.Raw = line
 		}
-
-		repeats, err := strconv.ParseUint(w[1], 10, 0)
-		if err != nil {
-			r.stateError(
-				"lirc repeat count not parseable as decimal (invalid repeat count)",
-				"repeat", w[1])
-			return
+		if r.opts.eventLogging {
+			r.logger.Debug(
+				"received button press",
+				"remote", event.RemoteControlName,
+				"button", event.ButtonName,
+				"code", FormatCode(event.Code),
+				"repeat", event.RepeatCount)
 		}
 
-		event := ButtonPress{
-			Code:              binary.LittleEndian.Uint16(c),
-			RepeatCount:       uint(repeats),
-			ButtonName:        w[2],
-			RemoteControlName: w[3],
-		}
+		r.events(ctx, event)
 
-		select {
-		case <-ctx.Done():
+	case stateReply:
+		if line == "END" {
+			// Without the command, the reply can't be made sense of, so
+			// fail the command it was presumably meant for.
+			r.replyError("lirc reply message received has no command, discarding reply")
 			return
-		case r.events <- event:
 		}
 
-	case stateReply:
 		r.reply = CommandReply{
 			Command: line,
 			Success: true,
@@ -355,15 +1160,19 @@ func (r *lircReader) read(ctx context.Context, line string) {
 	case stateStatus:
 		switch line {
 		case "SUCCESS":
+			r.reply.Status = StatusSuccess
 			r.setState(stateDataStart)
 		case "ERROR":
+			r.reply.Status = StatusError
 			r.reply.Success = false
 			r.setState(stateDataStart)
 		case "END":
+			// SIGHUP broadcasts have no status. Replies that are cut short
+			// like this are taken as successful replies without data.
 			r.setState(stateReceive)
 			r.flushReply(ctx)
 		default:
-			r.stateError(
+			r.replyError(
 				"lirc reply message received has invalid status",
 				"line", line)
 			return
@@ -377,7 +1186,7 @@ func (r *lircReader) read(ctx context.Context, line string) {
 			r.setState(stateReceive)
 			r.flushReply(ctx)
 		default:
-			r.stateError(
+			r.replyError(
 				"lirc reply message received has invalid data start",
 				"line", line)
 			return
@@ -387,18 +1196,40 @@ func (r *lircReader) read(ctx context.Context, line string) {
 		var err error
 		r.dataLength, err = strconv.Atoi(line)
 		if err != nil {
-			r.stateError(
+			r.replyError(
 				"lirc reply message received has invalid data length",
 				"line", line)
 			return
 		}
 
-		r.setState(stateData)
+		if r.dataLength < 0 || r.dataLength > maxDataLength {
+			r.replyError(
+				"lirc reply message received has absurd data length, discarding reply",
+				"length", r.dataLength)
+			return
+		}
+
+		if r.dataLength > r.opts.maxReplyLines {
+			r.discardReply(fmt.Errorf(
+				"%w: %d DATA lines, at most %d are allowed",
+				ErrReplyTooLarge, r.dataLength, r.opts.maxReplyLines))
+			return
+		}
+
 		r.dataCount = 0
-		r.reply.Data = make([]string, 0, r.dataLength)
+		// Don't trust the declared length for the allocation; let the slice
+		// grow as lines actually arrive.
+		r.reply.Data = make([]string, 0, min(r.dataLength, maxDataPrealloc))
+
+		if r.dataLength == 0 {
+			r.setState(stateDataEnd)
+		} else {
+			r.setState(stateData)
+		}
 
 	case stateData:
 		r.reply.Data = append(r.reply.Data, line)
+		r.feedData(ctx, line)
 		r.dataCount++
 		if r.dataCount >= r.dataLength {
 			r.setState(stateDataEnd)
@@ -406,7 +1237,7 @@ func (r *lircReader) read(ctx context.Context, line string) {
 
 	case stateDataEnd:
 		if line != "END" {
-			r.stateError(
+			r.replyError(
 				"lirc reply message received has invalid data end, discarding reply",
 				"line", line)
 			return
@@ -414,5 +1245,20 @@ func (r *lircReader) read(ctx context.Context, line string) {
 
 		r.flushReply(ctx)
 		r.setState(stateReceive)
+
+	case stateDataDiscard:
+		if r.dataCount < r.dataLength {
+			r.dataCount++
+			return
+		}
+
+		if line != "END" {
+			r.stateError(
+				"lirc reply message received has invalid data end, discarding reply",
+				"line", line)
+			return
+		}
+
+		r.setState(stateReceive)
 	}
 }
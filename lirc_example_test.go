@@ -2,9 +2,11 @@ package lirc_test
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
 
 	"libdb.so/go-lirc"
 )
@@ -101,3 +103,30 @@ func ExampleRouteEvents() {
 
 	// WaitGroup omitted for brevity.
 }
+
+// fakeSender is a lirc.Sender that prints commands instead of sending them.
+type fakeSender struct{}
+
+func (fakeSender) SendCommand(ctx context.Context, command lirc.Command) (lirc.CommandReply, error) {
+	encoded := command.EncodeCommand()
+	fmt.Println("sent:", strings.Join(encoded, " "))
+	return lirc.CommandReply{Command: encoded[0], Success: true}, nil
+}
+
+// powerOn only depends on lirc.Sender, so it can be tested without lircd.
+func powerOn(ctx context.Context, sender lirc.Sender) error {
+	_, err := sender.SendCommand(ctx, lirc.SendOnce{
+		RemoteControl: "Samsung_BN59-00516A_TV",
+		ButtonName:    "KEY_POWER",
+	})
+	return err
+}
+
+func ExampleSender() {
+	if err := powerOn(context.Background(), fakeSender{}); err != nil {
+		fmt.Println("error:", err)
+	}
+
+	// Output:
+	// sent: SEND_ONCE Samsung_BN59-00516A_TV KEY_POWER
+}
@@ -0,0 +1,97 @@
+package lirc
+
+import (
+	"context"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/neilotoole/slogt"
+)
+
+func TestTCPOptions(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err, "listen")
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	sockopt := func(t *testing.T, conn net.Conn, level, opt int) int {
+		raw, err := conn.(*net.TCPConn).SyscallConn()
+		assert.NoError(t, err, "syscall conn")
+
+		var value int
+		var sockErr error
+		err = raw.Control(func(fd uintptr) {
+			value, sockErr = syscall.GetsockoptInt(int(fd), level, opt)
+		})
+		assert.NoError(t, err, "control")
+		assert.NoError(t, sockErr, "getsockopt")
+		return value
+	}
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		noDelay   int
+		keepAlive int
+		keepIdle  int
+	}{
+		{"default", nil, 1, 1, 15},
+		{"custom", []Option{WithTCPNoDelay(false), WithTCPKeepAlive(42 * time.Second)}, 0, 1, 42},
+		{"no keepalive", []Option{WithTCPKeepAlive(-1)}, 1, 0, -1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn, err := NewTCP(listener.Addr().String(), test.opts...).dialer(context.Background())
+			assert.NoError(t, err, "dial")
+			t.Cleanup(func() { conn.Close() })
+
+			assert.Equal(t, test.noDelay, sockopt(t, conn, syscall.IPPROTO_TCP, syscall.TCP_NODELAY), "TCP_NODELAY")
+			assert.Equal(t, test.keepAlive, sockopt(t, conn, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE), "SO_KEEPALIVE")
+			if test.keepIdle != -1 {
+				assert.Equal(t, test.keepIdle, sockopt(t, conn, syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE), "TCP_KEEPIDLE")
+			}
+		})
+	}
+}
+
+func TestNewFromFD(t *testing.T) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	assert.NoError(t, err, "socketpair")
+
+	server, err := net.FileConn(os.NewFile(uintptr(fds[1]), "server"))
+	assert.NoError(t, err, "server end")
+	syscall.Close(fds[1])
+	srv := newMockServer(t, mockSuccess)
+	go srv.serve(server)
+
+	conn, err := NewFromFD(uintptr(fds[0]))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- conn.Start(ctx, slogt.New(t)) }()
+
+	_, err = conn.SendCommand(ctx, Version{})
+	assert.NoError(t, err, "command is sent on the inherited socket")
+
+	server.Close()
+	assert.Error(t, <-errc, "connection is lost")
+
+	err = conn.Start(ctx, slogt.New(t))
+	assert.IsError(t, err, ErrCannotRedial, "socket can't be reused")
+}
@@ -0,0 +1,231 @@
+package lirc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/neilotoole/slogt"
+)
+
+// mockHandler handles a single command line received by a mockServer and
+// returns the lines to write back. Returning nil writes nothing.
+type mockHandler func(line string) []string
+
+// mockReply builds the lines of a lircd reply packet.
+func mockReply(command string, success bool, data ...string) []string {
+	status := "SUCCESS"
+	if !success {
+		status = "ERROR"
+	}
+
+	lines := []string{"BEGIN", command, status}
+	if len(data) > 0 {
+		lines = append(lines, "DATA", strconv.Itoa(len(data)))
+		lines = append(lines, data...)
+	}
+	return append(lines, "END")
+}
+
+// mockSuccess is a mockHandler that replies SUCCESS to every command. Like
+// lircd, it echoes the whole command line.
+func mockSuccess(line string) []string {
+	return mockReply(line, true)
+}
+
+// mockServer is a scripted lircd. Every connection dialed through it is an
+// in-memory pipe served by its handler.
+type mockServer struct {
+	t       *testing.T
+	handler mockHandler
+
+	mu       sync.Mutex
+	conn     net.Conn
+	commands []string
+}
+
+func newMockServer(t *testing.T, handler mockHandler) *mockServer {
+	return &mockServer{t: t, handler: handler}
+}
+
+func (s *mockServer) dial(ctx context.Context) (net.Conn, error) {
+	client, server := net.Pipe()
+
+	s.mu.Lock()
+	s.conn = server
+	s.mu.Unlock()
+
+	go s.serve(server)
+	return client, nil
+}
+
+func (s *mockServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		s.mu.Lock()
+		s.commands = append(s.commands, line)
+		s.mu.Unlock()
+
+		if reply := s.handler(line); reply != nil {
+			s.write(conn, reply...)
+		}
+	}
+}
+
+func (s *mockServer) write(conn net.Conn, lines ...string) {
+	s.writeRaw(conn, strings.Join(lines, "\n")+"\n")
+}
+
+func (s *mockServer) writeRaw(conn net.Conn, raw string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := conn.Write([]byte(raw)); err != nil && !errors.Is(err, net.ErrClosed) {
+		s.t.Log("mock server write error:", err)
+	}
+}
+
+// broadcast writes lines to the most recently dialed connection. It waits for
+// the first connection to be dialed.
+func (s *mockServer) broadcast(lines ...string) {
+	s.write(s.current(), lines...)
+}
+
+// broadcastRaw is like broadcast, but it writes raw as-is.
+func (s *mockServer) broadcastRaw(raw string) {
+	s.writeRaw(s.current(), raw)
+}
+
+// hangup closes the most recently dialed connection.
+func (s *mockServer) hangup() {
+	s.current().Close()
+}
+
+func (s *mockServer) current() net.Conn {
+	var conn net.Conn
+	eventually(s.t, func() bool {
+		s.mu.Lock()
+		conn = s.conn
+		s.mu.Unlock()
+		return conn != nil
+	}, "connection to be dialed")
+	return conn
+}
+
+// received returns every command line received so far, in order.
+func (s *mockServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// startTestConnection runs conn.Start in the background until the test ends.
+func startTestConnection(t *testing.T, conn *Connection) context.Context {
+	return startTestConnectionLogger(t, conn, slogt.New(t))
+}
+
+// startTestConnectionLogger is like startTestConnection, but it logs to the
+// given logger.
+func startTestConnectionLogger(t *testing.T, conn *Connection, logger *slog.Logger) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- conn.Start(ctx, logger)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		if err := <-errCh; err != nil && !errors.Is(err, context.Canceled) {
+			assert.NoError(t, err, "lirc connection failed")
+		}
+	})
+
+	return ctx
+}
+
+// eventually polls cond until it returns true or the test times out.
+func eventually(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for", msg)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// logRecorder is a slog.Handler that records every log record.
+type logRecorder struct {
+	mu      *sync.Mutex
+	records *[]slog.Record
+	attrs   []slog.Attr
+}
+
+func newLogRecorder() *logRecorder {
+	return &logRecorder{
+		mu:      new(sync.Mutex),
+		records: new([]slog.Record),
+	}
+}
+
+func (h *logRecorder) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *logRecorder) Handle(_ context.Context, r slog.Record) error {
+	r = r.Clone()
+	r.AddAttrs(h.attrs...)
+
+	h.mu.Lock()
+	*h.records = append(*h.records, r)
+	h.mu.Unlock()
+	return nil
+}
+
+func (h *logRecorder) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = append(append([]slog.Attr(nil), h.attrs...), attrs...)
+	return &h2
+}
+
+func (h *logRecorder) WithGroup(string) slog.Handler { return h }
+
+// find returns every recorded record with the given message.
+func (h *logRecorder) find(msg string) []slog.Record {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var found []slog.Record
+	for _, r := range *h.records {
+		if r.Message == msg {
+			found = append(found, r)
+		}
+	}
+	return found
+}
+
+// recordAttr returns the value of the attribute with the given key in r.
+func recordAttr(r slog.Record, key string) slog.Value {
+	var value slog.Value
+	r.Attrs(func(attr slog.Attr) bool {
+		if attr.Key == key {
+			value = attr.Value
+			return false
+		}
+		return true
+	})
+	return value
+}
@@ -0,0 +1,989 @@
+package lirc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/neilotoole/slogt"
+)
+
+func TestReloadLogLevel(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []Option
+		level slog.Level
+	}{
+		{"default", nil, slog.LevelInfo},
+		{"debug", []Option{WithReloadLogLevel(slog.LevelDebug)}, slog.LevelDebug},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := newMockServer(t, mockSuccess)
+			conn := newConnection(srv.dial, test.opts)
+
+			logs := newLogRecorder()
+			ctx := startTestConnectionLogger(t, conn, slog.New(logs))
+
+			srv.broadcast("BEGIN", "SIGHUP", "END")
+			eventually(t, func() bool { return len(logs.find("lircd has been reloaded")) > 0 }, "reload log")
+
+			records := logs.find("lircd has been reloaded")
+			assert.Equal(t, 1, len(records), "reload is logged once")
+			assert.Equal(t, test.level, records[0].Level, "reload log level")
+
+			_, err := conn.SendCommand(ctx, Version{})
+			assert.NoError(t, err, "SIGHUP is not mistaken for a reply")
+		})
+	}
+}
+
+// readEvents feeds lines to a new lircReader and returns the events it
+// produced.
+func readEvents(t *testing.T, opts options, lines ...string) []ButtonPress {
+	var presses []ButtonPress
+	reader := newLircReader(slogt.New(t), &opts, func(_ context.Context, event ButtonPress) {
+		presses = append(presses, event)
+	}, nil)
+	for _, line := range lines {
+		reader.read(context.Background(), line)
+	}
+	return presses
+}
+
+func TestReadEventRepeatCount(t *testing.T) {
+	// lircd writes the repeat count with %02x, so it is hexadecimal.
+	events := readEvents(t, defaultOptions(),
+		"00000000e0e0e01f 09 KEY_VOLUMEUP remote",
+		"00000000e0e0e01f 0a KEY_VOLUMEUP remote",
+		"00000000e0e0e01f 10 KEY_VOLUMEUP remote")
+	assert.Equal(t, 3, len(events))
+	assert.Equal(t, uint(9), events[0].RepeatCount)
+	assert.Equal(t, uint(10), events[1].RepeatCount)
+	assert.Equal(t, uint(16), events[2].RepeatCount)
+}
+
+func TestReadEventCode(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		code uint64
+	}{
+		{"8 digits", "0000e0e0 0 KEY_POWER remote", 0xe0e0},
+		{"12 digits", "00e0e040bf00 0 KEY_POWER remote", 0xe0e040bf00},
+		{"16 digits", "00000000e0e040bf 0 KEY_POWER remote", 0xe0e040bf},
+		{"16 digits large", "ffffffffffffffff 0 KEY_POWER remote", 0xffffffffffffffff},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events := readEvents(t, defaultOptions(), test.line)
+			assert.Equal(t, []ButtonPress{{
+				Code:              test.code,
+				ButtonName:        "KEY_POWER",
+				RemoteControlName: "remote",
+			}}, events)
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		events := readEvents(t, defaultOptions(),
+			"not-hex 0 KEY_POWER remote",
+			"10000000000000000 0 KEY_POWER remote",
+			"0000e0e0 0 KEY_POWER")
+		assert.Equal(t, 0, len(events), "invalid events are dropped")
+	})
+}
+
+func TestCodeWidth(t *testing.T) {
+	const wide = "00000000e0e040bf0000 0 KEY_POWER remote"
+
+	events := readEvents(t, defaultOptions(), wide)
+	assert.Equal(t, 0, len(events), "codes wider than 16 digits are dropped by default")
+
+	opts := defaultOptions()
+	WithCodeWidth(20)(&opts)
+
+	events = readEvents(t, opts, wide, "10000000000000000000 0 KEY_POWER remote")
+	assert.Equal(t, []ButtonPress{{
+		Code:              0xe0e040bf0000,
+		ButtonName:        "KEY_POWER",
+		RemoteControlName: "remote",
+	}}, events, "wider codes are parsed, but must fit in 64 bits")
+
+	opts = defaultOptions()
+	WithCodeWidth(0)(&opts)
+
+	events = readEvents(t, opts, "00000000e0e040bf 0 KEY_POWER remote", wide)
+	assert.Equal(t, []ButtonPress{{
+		Code:              0xe0e040bf,
+		ButtonName:        "KEY_POWER",
+		RemoteControlName: "remote",
+	}}, events, "a width of 0 uses the default")
+}
+
+func TestRawEvents(t *testing.T) {
+	const line = "00000000e0e040bf 00 KEY_POWER remote"
+
+	events := readEvents(t, defaultOptions(), line)
+	assert.Equal(t, "", events[0].Raw, "raw line is not kept by default")
+
+	opts := defaultOptions()
+	WithRawEvents()(&opts)
+
+	events = readEvents(t, opts, line)
+	assert.Equal(t, line, events[0].Raw, "raw line is kept")
+}
+
+func TestEventLogging(t *testing.T) {
+	opts := defaultOptions()
+	opts.eventLogging = true
+
+	logs := newLogRecorder()
+	reader := newLircReader(slog.New(logs), &opts, func(context.Context, ButtonPress) {}, nil)
+	reader.read(context.Background(), "0000000000f40bf0 1a KEY_VOLUMEUP samsung")
+
+	records := logs.find("received button press")
+	assert.Equal(t, 1, len(records), "press is logged")
+	assert.Equal(t, slog.LevelDebug, records[0].Level, "at debug level")
+	assert.Equal(t, "samsung", recordAttr(records[0], "remote").String(), "remote")
+	assert.Equal(t, "KEY_VOLUMEUP", recordAttr(records[0], "button").String(), "button")
+	assert.Equal(t, "0000000000f40bf0", recordAttr(records[0], "code").String(), "code")
+	assert.Equal(t, uint64(0x1a), recordAttr(records[0], "repeat").Uint64(), "repeat count")
+}
+
+// brokenConn is a net.Conn whose writes always fail.
+type brokenConn struct {
+	net.Conn
+	err error
+}
+
+func (c brokenConn) Write([]byte) (int, error) { return 0, c.err }
+
+func TestSendCommandWriteError(t *testing.T) {
+	errBroken := errors.New("broken pipe")
+
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(func(ctx context.Context) (net.Conn, error) {
+		c, err := srv.dial(ctx)
+		return brokenConn{c, errBroken}, err
+	}, []Option{withClock(newFakeClock())})
+
+	startErr := make(chan error, 1)
+	go func() { startErr <- conn.Start(context.Background(), slogt.New(t)) }()
+
+	_, err := conn.SendCommand(context.Background(), Version{})
+	assert.IsError(t, err, errBroken, "SendCommand returns the write error")
+	assert.IsError(t, <-startErr, errBroken, "Start returns the write error")
+}
+
+// shortConn is a net.Conn that fails in the middle of writing once n bytes
+// were written to it.
+type shortConn struct {
+	net.Conn
+	n   int
+	err error
+}
+
+func (c *shortConn) Write(b []byte) (int, error) {
+	if len(b) <= c.n {
+		c.n -= len(b)
+		return c.Conn.Write(b)
+	}
+	n, _ := c.Conn.Write(b[:c.n])
+	c.n = 0
+	return n, c.err
+}
+
+func TestPartialWriteReconnects(t *testing.T) {
+	errShort := errors.New("short write")
+
+	var dials atomic.Int32
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(func(ctx context.Context) (net.Conn, error) {
+		c, err := srv.dial(ctx)
+		if dials.Add(1) == 1 {
+			return &shortConn{Conn: c, n: 3, err: errShort}, err
+		}
+		return c, err
+	}, []Option{WithReconnect(time.Millisecond)})
+	ctx := startTestConnection(t, conn)
+
+	assert.NoError(t, conn.WaitConnected(ctx))
+	_, err := conn.SendCommand(ctx, Version{})
+	assert.IsError(t, err, errShort, "command fails on a partial write")
+	assert.Contains(t, err.Error(), "wrote 3 of 8 bytes")
+
+	eventually(t, func() bool { return dials.Load() == 2 && conn.Connected() }, "reconnect")
+
+	_, err = conn.SendCommand(ctx, Version{})
+	assert.NoError(t, err, "command succeeds on the new connection")
+	assert.Equal(t, []string{"VER", "VERSION"}, srv.received(),
+		"truncated command is followed by a fresh connection")
+}
+
+// lateFailConn is a net.Conn whose writes only go through once proceed is
+// closed, and then fail once wrote returns.
+type lateFailConn struct {
+	net.Conn
+	proceed chan struct{}
+	wrote   func()
+	err     error
+}
+
+func (c lateFailConn) Write(b []byte) (int, error) {
+	<-c.proceed
+	n, _ := c.Conn.Write(b)
+	c.wrote()
+	return n, c.err
+}
+
+func TestWriteErrorAfterReply(t *testing.T) {
+	errLate := errors.New("connection reset")
+	logs := newLogRecorder()
+
+	srv := newMockServer(t, mockSuccess)
+	proceed := make(chan struct{})
+	conn := newConnection(func(ctx context.Context) (net.Conn, error) {
+		c, err := srv.dial(ctx)
+		return lateFailConn{c, proceed, func() {
+			// Fail only once the reply was read and handed to the command.
+			for len(logs.find("delivered reply")) == 0 {
+				time.Sleep(time.Millisecond)
+			}
+		}, errLate}, err
+	}, nil)
+
+	startErr := make(chan error, 1)
+	go func() { startErr <- conn.Start(context.Background(), slog.New(logs)) }()
+	assert.NoError(t, conn.WaitConnected(context.Background()))
+
+	// The caller gives up while the command is being written, so nobody
+	// receives its reply.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		eventually(t, func() bool { return len(logs.find("sending command to lircd")) == 1 }, "command is being written")
+		cancel()
+	}()
+	_, err := conn.SendCommand(ctx, Version{})
+	assert.IsError(t, err, context.Canceled)
+	close(proceed)
+
+	select {
+	case err := <-startErr:
+		assert.IsError(t, err, errLate, "Start returns the write error")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start hangs after the write error")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	errBroken := errors.New("broken pipe")
+
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(func(ctx context.Context) (net.Conn, error) {
+		c, err := srv.dial(ctx)
+		return brokenConn{c, errBroken}, err
+	}, []Option{withClock(newFakeClock())})
+
+	startErr := make(chan error, 1)
+	go func() { startErr <- conn.Start(context.Background(), slogt.New(t)) }()
+
+	srv.broadcast("garbage")
+	assert.IsError(t, <-conn.Errors(), ErrProtocol, "malformed line is reported")
+
+	conn.SendCommand(context.Background(), Version{})
+	assert.IsError(t, <-conn.Errors(), errBroken, "write error is reported")
+	<-startErr
+}
+
+func TestReceiveOnlyGoroutines(t *testing.T) {
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, []Option{WithReceiveOnly()})
+	ctx := startTestConnection(t, conn)
+	assert.NoError(t, conn.WaitConnected(ctx))
+
+	var stacks string
+	eventually(t, func() bool {
+		buf := make([]byte, 1<<20)
+		stacks = string(buf[:runtime.Stack(buf, true)])
+		return strings.Contains(stacks, "(*lircReader).pump")
+	}, "reader")
+	assert.NotContains(t, stacks, "(*Connection).sendLoop", "sender doesn't run")
+
+	_, err := conn.TrySendCommand(Version{})
+	assert.IsError(t, err, ErrSendDisabled, "commands are rejected")
+	assert.IsError(t, conn.WriteRaw(ctx, []byte("VERSION\n")), ErrSendDisabled, "raw writes are rejected")
+}
+
+func TestReceiveOnly(t *testing.T) {
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, []Option{WithReceiveOnly()})
+	ctx := startTestConnection(t, conn)
+
+	srv.broadcast("000000000000e0e0 0 KEY_POWER remote")
+	event := <-conn.Events
+	assert.Equal(t, "KEY_POWER", event.ButtonName, "events are received")
+
+	// Unsolicited replies must not block the reader.
+	srv.broadcast("BEGIN", "SIGHUP", "END")
+	srv.broadcast("BEGIN", "VERSION", "SUCCESS", "END")
+	srv.broadcast("000000000000e0e0 1 KEY_POWER remote")
+	event = <-conn.Events
+	assert.Equal(t, uint(1), event.RepeatCount, "events are received after replies")
+
+	_, err := conn.SendCommand(ctx, Version{})
+	assert.IsError(t, err, ErrSendDisabled, "commands are rejected")
+	assert.Equal(t, 0, len(srv.received()), "nothing is written to lircd")
+}
+
+func TestSplitFunc(t *testing.T) {
+	scanNUL := func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, 0); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+
+	var srv *mockServer
+	srv = newMockServer(t, func(line string) []string {
+		srv.broadcastRaw("BEGIN\x00VERSION\x00SUCCESS\x00DATA\x001\x000.10.2\x00END\x00")
+		return nil
+	})
+	conn := newConnection(srv.dial, []Option{WithSplitFunc(scanNUL)})
+	ctx := startTestConnection(t, conn)
+
+	srv.broadcastRaw("000000000000e0e0 0 KEY_POWER remote\x00")
+	event := <-conn.Events
+	assert.Equal(t, "KEY_POWER", event.ButtonName, "event is split on NUL")
+
+	reply, err := conn.SendCommand(ctx, Version{})
+	assert.NoError(t, err, "send version")
+	assert.Equal(t, []string{"0.10.2"}, reply.Data, "reply is split on NUL")
+}
+
+func TestPipelining(t *testing.T) {
+	const depth = 3
+
+	// The mock only replies once it has received every command, which can
+	// only happen if they are pipelined.
+	var received []string
+	srv := newMockServer(t, func(line string) []string {
+		received = append(received, line)
+		if len(received) < depth {
+			return nil
+		}
+
+		var lines []string
+		for _, line := range received {
+			lines = append(lines, mockReply("SEND_ONCE", true, line)...)
+		}
+		return lines
+	})
+	conn := newConnection(srv.dial, []Option{WithPipelining(depth)})
+	ctx := startTestConnection(t, conn)
+
+	var wg sync.WaitGroup
+	replies := make([]CommandReply, depth)
+	errs := make([]error, depth)
+	for i := range depth {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			replies[i], errs[i] = conn.SendCommand(ctx, SendOnce{
+				RemoteControl: "remote",
+				ButtonName:    fmt.Sprintf("button%d", i),
+			})
+		}()
+	}
+	wg.Wait()
+
+	for i := range depth {
+		assert.NoError(t, errs[i], "command %d", i)
+		assert.Equal(t,
+			[]string{fmt.Sprintf("SEND_ONCE remote button%d", i)},
+			replies[i].Data,
+			"command %d gets its own reply", i)
+	}
+}
+
+func TestReplyLost(t *testing.T) {
+	var srv *mockServer
+	srv = newMockServer(t, func(line string) []string {
+		if line == "LIST" {
+			// Drop the END and start another packet right away.
+			return append([]string{"BEGIN", "LIST", "SUCCESS", "DATA", "1"},
+				"BEGIN", "SIGHUP", "END")
+		}
+		return mockSuccess(line)
+	})
+	conn := newConnection(srv.dial, []Option{withClock(newFakeClock())})
+	ctx := startTestConnection(t, conn)
+
+	_, err := conn.SendCommand(ctx, List{})
+	assert.IsError(t, err, ErrReplyLost, "interrupted reply is lost")
+
+	_, err = conn.SendCommand(ctx, Version{})
+	assert.NoError(t, err, "connection resynchronizes")
+}
+
+func TestErrorLogThrottle(t *testing.T) {
+	const window = 10 * time.Second
+
+	clock := newFakeClock()
+	opts := defaultOptions()
+	opts.clock = clock
+	opts.errorLogThrottle = window
+
+	logs := newLogRecorder()
+	reader := newLircReader(slog.New(logs), &opts, nil, nil)
+
+	for range 100 {
+		reader.read(context.Background(), "garbage")
+	}
+
+	records := logs.find("lirc error")
+	assert.Equal(t, 1, len(records), "identical errors are coalesced")
+
+	clock.Advance(window)
+	reader.read(context.Background(), "garbage")
+
+	records = logs.find("lirc error")
+	assert.Equal(t, 2, len(records), "error is logged again after the window")
+	assert.Equal(t, int64(99), recordAttr(records[1], "suppressed").Int64(), "suppressed count")
+
+	opts.errorLogThrottle = 0
+	for range 3 {
+		reader.read(context.Background(), "garbage")
+	}
+	assert.Equal(t, 5, len(logs.find("lirc error")), "throttling can be disabled")
+}
+
+func TestConnEvents(t *testing.T) {
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, []Option{WithConnEvents()})
+	startTestConnection(t, conn)
+
+	srv.broadcast("000000000000e0e0 0 KEY_POWER remote")
+	event := <-conn.ConnEvents
+	assert.Equal(t, "KEY_POWER", event.ButtonName, "event is received")
+	assert.True(t, event.Conn == conn, "event carries its connection")
+
+	_, err := event.Conn.SendCommand(context.Background(), SendOnce{RemoteControl: "remote", ButtonName: "KEY_POWER"})
+	assert.NoError(t, err, "reply on the event's connection")
+}
+
+func TestReadDataLength(t *testing.T) {
+	readReply := func(t *testing.T, lines ...string) (*lircReader, *logRecorder, chan commandResult) {
+		logs := newLogRecorder()
+		opts := defaultOptions()
+		inflight := newInflight(1)
+		reader := newLircReader(slog.New(logs), &opts, nil, inflight)
+
+		pending := &pendingCommand{command: List{}, result: make(chan commandResult, 1)}
+		inflight.push(pending)
+
+		for _, line := range lines {
+			reader.read(context.Background(), line)
+		}
+		return reader, logs, pending.result
+	}
+
+	t.Run("absurd", func(t *testing.T) {
+		reader, logs, result := readReply(t, "BEGIN", "LIST", "SUCCESS", "DATA", "2000000000")
+		assert.Equal(t, stateReceive, reader.state, "reader resets")
+		assert.True(t, cap(reader.reply.Data) <= maxDataPrealloc, "no huge allocation")
+		assert.Equal(t, 1, len(logs.find("lirc error")), "error is logged")
+
+		err := (<-result).err
+		assert.IsError(t, err, ErrProtocol, "command fails right away")
+		assert.IsError(t, err, ErrReplyLost)
+		assert.True(t, reader.inflight.front() == nil, "command is no longer in flight")
+	})
+
+	t.Run("absurd then more commands", func(t *testing.T) {
+		srv := newMockServer(t, func(line string) []string {
+			if line == "LIST" {
+				return []string{"BEGIN", line, "SUCCESS", "DATA", "2000000000", "END"}
+			}
+			return mockSuccess(line)
+		})
+		conn := newConnection(srv.dial, nil)
+		ctx := startTestConnection(t, conn)
+
+		_, err := conn.SendCommand(ctx, List{})
+		assert.IsError(t, err, ErrProtocol)
+
+		_, err = conn.SendCommand(ctx, Version{})
+		assert.NoError(t, err, "later commands are still sent")
+	})
+
+	t.Run("large", func(t *testing.T) {
+		lines := []string{"BEGIN", "LIST", "SUCCESS", "DATA", "1000"}
+		for i := range 1000 {
+			lines = append(lines, strconv.Itoa(i))
+		}
+		lines = append(lines, "END")
+
+		_, _, result := readReply(t, lines...)
+		reply := (<-result).reply
+		assert.Equal(t, 1000, len(reply.Data), "all lines are received")
+		assert.Equal(t, "999", reply.Data[999], "last line")
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		_, _, result := readReply(t, "BEGIN", "LIST", "SUCCESS", "DATA", "0", "END")
+		assert.Equal(t, 0, len((<-result).reply.Data), "no data")
+	})
+}
+
+func TestMaxReplyLines(t *testing.T) {
+	srv := newMockServer(t, func(line string) []string {
+		if line == "LIST" {
+			return mockReply(line, true, "1", "2", "3", "4", "5")
+		}
+		return mockSuccess(line)
+	})
+	conn := newConnection(srv.dial, []Option{WithMaxReplyLines(3)})
+	ctx := startTestConnection(t, conn)
+
+	_, err := conn.SendCommand(ctx, List{})
+	assert.IsError(t, err, ErrReplyTooLarge, "reply exceeds the limit")
+
+	_, err = conn.SendCommand(ctx, Version{})
+	assert.NoError(t, err, "connection resynchronizes")
+}
+
+func TestMaxReplyLinesOverstated(t *testing.T) {
+	srv := newMockServer(t, func(line string) []string {
+		if line == "LIST" {
+			// Claims more DATA lines than it has, so the next reply starts
+			// while this one is being discarded.
+			return []string{"BEGIN", line, "SUCCESS", "DATA", "1000", "1", "2", "END"}
+		}
+		return mockSuccess(line)
+	})
+	conn := newConnection(srv.dial, []Option{WithMaxReplyLines(3)})
+	ctx := startTestConnection(t, conn)
+
+	_, err := conn.SendCommand(ctx, List{})
+	assert.IsError(t, err, ErrReplyTooLarge, "reply exceeds the limit")
+
+	_, err = conn.SendCommand(ctx, Version{})
+	assert.NoError(t, err, "next reply isn't taken as lost")
+}
+
+func TestMaxReplyLinesDefault(t *testing.T) {
+	srv := newMockServer(t, func(line string) []string {
+		if line == "LIST" {
+			return mockReply(line, true, "1", "2", "3")
+		}
+		return mockSuccess(line)
+	})
+	conn := newConnection(srv.dial, []Option{WithMaxReplyLines(0)})
+	ctx := startTestConnection(t, conn)
+
+	reply, err := conn.SendCommand(ctx, List{})
+	assert.NoError(t, err, "0 uses the default limit")
+	assert.Equal(t, []string{"1", "2", "3"}, reply.Data)
+}
+
+func TestReplyStatus(t *testing.T) {
+	srv := newMockServer(t, func(line string) []string {
+		return mockReply(line, line == "VERSION")
+	})
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+
+	reply, err := conn.SendCommand(ctx, Version{})
+	assert.NoError(t, err)
+	assert.Equal(t, StatusSuccess, reply.Status, "SUCCESS")
+	assert.True(t, reply.Success, "success is derived from the status")
+
+	reply, err = conn.SendCommand(ctx, List{})
+	assert.IsError(t, err, ErrUnsuccessfulCommand)
+	assert.Equal(t, StatusError, reply.Status, "ERROR")
+	assert.False(t, reply.Success, "success is derived from the status")
+}
+
+func TestCommandReplyArgs(t *testing.T) {
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+
+	reply, err := conn.SendCommand(ctx, SendOnce{RemoteControl: "tv", ButtonName: "KEY_POWER", Repeats: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, "SEND_ONCE", reply.Verb(), "verb")
+	assert.Equal(t, []string{"tv", "KEY_POWER", "2"}, reply.Args(), "echoed arguments")
+	assert.Zero(t, reply.Data, "no data")
+
+	reply, err = conn.SendCommand(ctx, Version{})
+	assert.NoError(t, err)
+	assert.Equal(t, "VERSION", reply.Verb(), "verb")
+	assert.Zero(t, reply.Args(), "no arguments")
+}
+
+func TestCommandError(t *testing.T) {
+	srv := newMockServer(t, func(line string) []string {
+		switch line {
+		case "SEND_ONCE missing KEY_POWER":
+			return mockReply("SEND_ONCE", false, `unknown remote: "missing"`)
+		case "SEND_ONCE tv KEY_MISSING":
+			return mockReply("SEND_ONCE", false, `unknown command: "KEY_MISSING"`)
+		case "SEND_ONCE receiver KEY_POWER":
+			return mockReply("SEND_ONCE", false, "hardware does not support sending")
+		case "SEND_ONCE blaster KEY_POWER":
+			return mockReply("SEND_ONCE", false, "transmission failed")
+		case "SEND_ONCE repeating KEY_POWER":
+			return mockReply("SEND_ONCE", false, "busy: repeating")
+		case "SEND_ONCE tv KEY_BROKEN":
+			return mockReply("SEND_ONCE", false)
+		default:
+			return mockSuccess(line)
+		}
+	})
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+
+	tests := []struct {
+		remote, button string
+		err            error
+		message        string
+	}{
+		{"missing", "KEY_POWER", ErrUnknownRemote, `unknown remote: "missing"`},
+		{"tv", "KEY_MISSING", ErrUnknownButton, `unknown command: "KEY_MISSING"`},
+		{"receiver", "KEY_POWER", ErrTransmitUnsupported, "hardware does not support sending"},
+		{"blaster", "KEY_POWER", ErrTransmitFailed, "transmission failed"},
+		{"repeating", "KEY_POWER", ErrRepeating, "busy: repeating"},
+		{"tv", "KEY_BROKEN", nil, ""},
+	}
+
+	for _, test := range tests {
+		_, err := conn.SendCommand(ctx, SendOnce{RemoteControl: test.remote, ButtonName: test.button})
+		assert.IsError(t, err, ErrUnsuccessfulCommand, "%s: unsuccessful", test.button)
+		if test.err != nil {
+			assert.IsError(t, err, test.err, "%s: mapped error", test.button)
+		}
+
+		var cmdErr *CommandError
+		assert.True(t, errors.As(err, &cmdErr), "%s: CommandError", test.button)
+		assert.Equal(t, test.message, cmdErr.Message, "%s: message is preserved", test.button)
+	}
+
+	_, err := conn.SendCommand(ctx, SendOnce{RemoteControl: "tv", ButtonName: "KEY_POWER"})
+	assert.NoError(t, err, "valid remote and button")
+}
+
+func TestSendCommandNotConnected(t *testing.T) {
+	// Never reply, so that the second command waits to be sent.
+	srv := newMockServer(t, func(string) []string { return nil })
+	conn := newConnection(srv.dial, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- conn.Start(ctx, slogt.New(t)) }()
+
+	assert.NoError(t, conn.WaitConnected(ctx))
+
+	sendErrs := make(chan error, 2)
+	for range 2 {
+		go func() {
+			_, err := conn.SendCommand(context.Background(), Version{})
+			sendErrs <- err
+		}()
+	}
+	eventually(t, func() bool { return len(srv.received()) == 1 }, "first command to be written")
+
+	cancel()
+	assert.IsError(t, <-errCh, context.Canceled, "connection is closed")
+
+	for range 2 {
+		select {
+		case err := <-sendErrs:
+			assert.IsError(t, err, ErrNotConnected, "command fails once the connection is gone")
+		case <-time.After(time.Second):
+			t.Fatal("command is still blocked after the connection is gone")
+		}
+	}
+}
+
+func TestRepeatFilter(t *testing.T) {
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, []Option{WithRepeatFilter(3)})
+	startTestConnection(t, conn)
+
+	go func() {
+		for i := range 8 {
+			srv.broadcast(FormatBroadcast(ButtonPress{RepeatCount: uint(i), ButtonName: "KEY_VOLUMEUP", RemoteControlName: "remote"}))
+		}
+		srv.broadcast(FormatBroadcast(ButtonPress{ButtonName: "KEY_MUTE", RemoteControlName: "remote"}))
+	}()
+
+	var repeats []uint
+	for event := range conn.Events {
+		if event.ButtonName == "KEY_MUTE" {
+			break
+		}
+		repeats = append(repeats, event.RepeatCount)
+	}
+	assert.Equal(t, []uint{0, 3, 6}, repeats, "every third repeat is delivered")
+}
+
+func TestDedup(t *testing.T) {
+	const window = 100 * time.Millisecond
+	const power = "00000000e0e040bf 00 KEY_POWER remote"
+	const mute = "00000000e0e0f00f 00 KEY_MUTE remote"
+
+	clock := newFakeClock()
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, []Option{withClock(clock), WithDedup(window)})
+	startTestConnection(t, conn)
+
+	go srv.broadcast(power, power, mute)
+	assert.Equal(t, "KEY_POWER", (<-conn.Events).ButtonName, "first press")
+	assert.Equal(t, "KEY_MUTE", (<-conn.Events).ButtonName, "duplicate within the window is dropped")
+
+	clock.Advance(window)
+	go srv.broadcast(power)
+	assert.Equal(t, "KEY_POWER", (<-conn.Events).ButtonName, "press after the window is delivered")
+}
+
+func TestAbandonedCommand(t *testing.T) {
+	release := make(chan struct{})
+	srv := newMockServer(t, func(line string) []string {
+		if strings.HasPrefix(line, "SEND_ONCE") {
+			<-release
+		}
+		return mockSuccess(line)
+	})
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+
+	sendCtx, cancel := context.WithCancel(ctx)
+	sent := make(chan error)
+	go func() {
+		_, err := conn.SendCommand(sendCtx, SendOnce{RemoteControl: "remote", ButtonName: "KEY_POWER"})
+		sent <- err
+	}()
+	eventually(t, func() bool { return len(srv.received()) == 1 }, "command in flight")
+
+	cancel()
+	assert.IsError(t, <-sent, context.Canceled, "caller gives up on the reply")
+
+	close(release)
+	reply, err := conn.SendCommand(ctx, Version{})
+	assert.NoError(t, err, "connection remains usable")
+	assert.Equal(t, "VERSION", reply.Verb(), "late reply goes to the abandoned command")
+}
+
+func TestReplyDuringShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := newMockServer(t, func(line string) []string {
+		// Shut down just as the reply is written.
+		cancel()
+		return mockSuccess(line)
+	})
+	// The fake clock never lets the reply timeout rescue a stalled caller.
+	conn := newConnection(srv.dial, []Option{withClock(newFakeClock())})
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- conn.Start(ctx, slogt.New(t)) }()
+
+	sendErr := make(chan error, 1)
+	go func() {
+		_, err := conn.SendCommand(context.Background(), Version{})
+		sendErr <- err
+	}()
+
+	select {
+	case err := <-sendErr:
+		if err != nil {
+			assert.IsError(t, err, ErrNotConnected, "reply or a prompt error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("caller stalled waiting for a reply during shutdown")
+	}
+
+	<-errCh
+}
+
+func TestPartialReplyTimeout(t *testing.T) {
+	clock := newFakeClock()
+	srv := newMockServer(t, func(line string) []string {
+		// Stall in the middle of the DATA.
+		return []string{"BEGIN", line, "SUCCESS", "DATA", "3", "tv", "amp"}
+	})
+	conn := newConnection(srv.dial, []Option{withClock(clock)})
+	ctx := startTestConnection(t, conn)
+
+	lines, errs := conn.ListStream(ctx, "")
+	assert.Equal(t, "tv", <-lines)
+	assert.Equal(t, "amp", <-lines)
+
+	clock.Advance(replyTimeout)
+	for range lines {
+	}
+
+	var partialErr *PartialReplyError
+	err := <-errs
+	assert.True(t, errors.As(err, &partialErr), "error carries the partial reply")
+	assert.Equal(t, "LIST", partialErr.Command)
+	assert.Equal(t, []string{"tv", "amp"}, partialErr.Data)
+	assert.IsError(t, err, context.DeadlineExceeded, "error wraps the timeout")
+}
+
+func TestReplyWithoutStatus(t *testing.T) {
+	srv := newMockServer(t, func(line string) []string {
+		return []string{"BEGIN", line, "END"}
+	})
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+
+	reply, err := conn.SendCommand(ctx, Version{})
+	assert.NoError(t, err, "reply without status is successful")
+	assert.Equal(t, CommandReply{Command: "VERSION", Success: true}, reply)
+
+	events := readEvents(t, defaultOptions(),
+		"BEGIN", "END",
+		"00000000e0e040bf 00 KEY_POWER remote")
+	assert.Equal(t, 1, len(events), "reply without command is discarded")
+
+	srv = newMockServer(t, func(line string) []string {
+		switch line {
+		case "LIST":
+			return []string{"BEGIN", "END"}
+		case "LIST tv":
+			return []string{"BEGIN", line, "MAYBE", "END"}
+		case "LIST amp":
+			return []string{"BEGIN", line, "SUCCESS", "DATA", "0", "DATA", "END"}
+		}
+		return mockSuccess(line)
+	})
+	conn = newConnection(srv.dial, nil)
+	ctx = startTestConnection(t, conn)
+
+	for _, remote := range []string{"", "tv", "amp"} {
+		_, err = conn.SendCommand(ctx, List{RemoteControl: remote})
+		assert.IsError(t, err, ErrProtocol, "malformed reply fails the command %q", remote)
+
+		_, err = conn.SendCommand(ctx, Version{})
+		assert.NoError(t, err, "command after a malformed reply succeeds")
+	}
+}
+
+func TestReplyMatcher(t *testing.T) {
+	srv := newMockServer(t, func(line string) []string {
+		return mockReply("  "+strings.ToLower(line), true)
+	})
+
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+	_, err := conn.SendCommand(ctx, SendOnce{RemoteControl: "tv", ButtonName: "KEY_POWER"})
+	assert.NoError(t, err, "echoed verb is matched ignoring case and spaces")
+
+	strict := newConnection(srv.dial, []Option{WithReplyMatcher(func(command Command, echoed string) bool {
+		return echoed == strings.Join(command.EncodeCommand(), " ")
+	})})
+	ctx = startTestConnection(t, strict)
+	_, err = strict.SendCommand(ctx, SendOnce{RemoteControl: "tv", ButtonName: "KEY_POWER"})
+	assert.Error(t, err, "custom matcher rejects the echo")
+}
+
+func TestEventTap(t *testing.T) {
+	tap := make(chan ButtonPress, 2)
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, []Option{WithEventTap(tap)})
+	startTestConnection(t, conn)
+
+	go srv.broadcast(
+		"00000000e0e040bf 00 KEY_POWER remote",
+		"00000000e0e040bf 01 KEY_POWER remote",
+		"00000000e0e0e01f 00 KEY_VOLUMEUP remote")
+	for _, button := range []string{"KEY_POWER", "KEY_POWER", "KEY_VOLUMEUP"} {
+		assert.Equal(t, button, (<-conn.Events).ButtonName, "events are delivered as usual")
+	}
+
+	assert.Equal(t, 2, len(tap), "tap drops presses once full")
+	assert.Equal(t, uint(0), (<-tap).RepeatCount)
+	assert.Equal(t, uint(1), (<-tap).RepeatCount)
+}
+
+func TestResync(t *testing.T) {
+	var versions atomic.Int32
+	srv := newMockServer(t, func(line string) []string {
+		if line == "VERSION" && versions.Add(1) == 1 {
+			// Claims more DATA lines than it has, so END and what follows is
+			// taken as data.
+			return []string{"BEGIN", "VERSION", "SUCCESS", "DATA", "5", "0.10.2", "END"}
+		}
+		return mockSuccess(line)
+	})
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := conn.SendCommand(ctx, Version{})
+		errc <- err
+	}()
+	eventually(t, func() bool { return len(srv.received()) == 1 }, "command to be sent")
+
+	// The broadcast is only written once the reader is done with the broken
+	// reply, and is swallowed as data too.
+	srv.broadcast("00000000e0e040bf 00 KEY_POWER remote")
+
+	conn.Resync()
+	go srv.broadcast("00000000e0e040bf 01 KEY_POWER remote")
+	assert.Equal(t, uint(1), (<-conn.Events).RepeatCount, "events parse after resync")
+	assert.IsError(t, <-errc, ErrReplyLost, "abandoned reply fails its command")
+
+	reply, err := conn.SendCommand(ctx, Version{})
+	assert.NoError(t, err, "replies parse after resync")
+	assert.Equal(t, "VERSION", reply.Command)
+}
+
+func TestResyncKeepsCompleteReply(t *testing.T) {
+	opts := defaultOptions()
+	reader := newLircReader(slogt.New(t), &opts, nil, nil)
+	var replies []CommandReply
+	reader.unclaimed = func(_ context.Context, reply CommandReply) { replies = append(replies, reply) }
+
+	resync := false
+	reader.resyncRequested = func() bool {
+		requested := resync
+		resync = false
+		return requested
+	}
+
+	for _, line := range []string{"BEGIN", "VERSION", "SUCCESS", "DATA", "1", "0.10.2"} {
+		reader.read(context.Background(), line)
+	}
+	resync = true
+	reader.read(context.Background(), "END")
+
+	assert.Equal(t, []CommandReply{{
+		Command: "VERSION",
+		Success: true,
+		Status:  StatusSuccess,
+		Data:    []string{"0.10.2"},
+	}}, replies, "reply that only needed its END is delivered")
+}
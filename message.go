@@ -1,12 +1,18 @@
 package lirc
 
-import "errors"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
 
 // ButtonPress represents the IR Remote Key Press ButtonPress
 type ButtonPress struct {
-	// Code is a 16 hexadecimal digits number encoding of the IR signal.
+	// Code is the numeric encoding of the IR signal. lircd usually sends it as
+	// a 16 hexadecimal digits number, but some drivers send fewer digits.
 	// It's usage in applications is deprecated and it should be ignored.
-	Code uint16
+	Code uint64
 	// RepeatCount shows how long the user has been holding down a button.
 	// The counter will start at 0 and increment each time a new IR signal has been received.
 	RepeatCount uint
@@ -14,17 +20,262 @@ type ButtonPress struct {
 	ButtonName string
 	// RemoteControlName is the mandatory name attribute in the lircd.conf config file.
 	RemoteControlName string
+	// Raw is the line received from lircd for this event. It is only set if
+	// the connection was created with [WithRawEvents].
+	Raw string
+}
+
+// String formats the button press for humans, with its code formatted by
+// [FormatCode].
+func (p ButtonPress) String() string {
+	s := fmt.Sprintf("%s %s (%s)", p.RemoteControlName, p.ButtonName, FormatCode(p.Code))
+	if p.RepeatCount > 0 {
+		s += fmt.Sprintf(" repeat %d", p.RepeatCount)
+	}
+	return s
+}
+
+// buttonPressJSON is the JSON representation of a ButtonPress.
+type buttonPressJSON struct {
+	Code              string `json:"code"`
+	RepeatCount       uint   `json:"repeatCount"`
+	ButtonName        string `json:"buttonName"`
+	RemoteControlName string `json:"remoteControlName"`
+	Raw               string `json:"raw,omitempty"`
+}
+
+// MarshalJSON implements [json.Marshaler]. The code is formatted by
+// [FormatCode], since JSON numbers can't hold every 64-bit code exactly.
+func (p ButtonPress) MarshalJSON() ([]byte, error) {
+	return json.Marshal(buttonPressJSON{
+		Code:              FormatCode(p.Code),
+		RepeatCount:       p.RepeatCount,
+		ButtonName:        p.ButtonName,
+		RemoteControlName: p.RemoteControlName,
+		Raw:               p.Raw,
+	})
+}
+
+// UnmarshalJSON implements [json.Unmarshaler]. The code is parsed by
+// [ParseCode].
+func (p *ButtonPress) UnmarshalJSON(b []byte) error {
+	var v buttonPressJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	code, err := ParseCode(v.Code)
+	if err != nil {
+		return fmt.Errorf("invalid code %q: %w", v.Code, err)
+	}
+
+	*p = ButtonPress{
+		Code:              code,
+		RepeatCount:       v.RepeatCount,
+		ButtonName:        v.ButtonName,
+		RemoteControlName: v.RemoteControlName,
+		Raw:               v.Raw,
+	}
+	return nil
+}
+
+// Event is a ButtonPress along with the connection it was received from. It is
+// sent on [Connection.ConnEvents] when [WithConnEvents] is used, so that
+// handlers can reply on the same connection.
+type Event struct {
+	ButtonPress
+	// Conn is the connection that received the button press.
+	Conn *Connection
 }
 
 // CommandReply is the message received after sending a command.
 type CommandReply struct {
-	// Command is the command that was sent to lircd.
+	// Command is the command that was sent to lircd, as echoed by lircd with
+	// its arguments. See [CommandReply.Verb] and [CommandReply.Args].
 	Command string
-	// Success is whether the command was successful.
+	// Status is the status sent by lircd.
+	Status Status
+	// Success is whether the command was successful, which is the case unless
+	// Status is StatusError.
 	Success bool
-	// Data is the data received from lircd.
+	// Data is the data received from lircd. On success, only [List] and
+	// [Version] return data: the remote controls or buttons, and the version.
+	// Unsuccessful commands return the error message, if any, which is also
+	// available from [CommandError]. lircd never echoes the arguments of a
+	// command in its data.
 	Data []string
 }
 
+// Status is the status of a [CommandReply].
+type Status uint8
+
+const (
+	// StatusUnknown is the status of replies that have none, such as the
+	// SIGHUP packet sent by lircd when it is reloaded.
+	StatusUnknown Status = iota
+	// StatusSuccess is sent by lircd as SUCCESS.
+	StatusSuccess
+	// StatusError is sent by lircd as ERROR.
+	StatusError
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusSuccess:
+		return "SUCCESS"
+	case StatusError:
+		return "ERROR"
+	default:
+		return "unknown"
+	}
+}
+
+// Verb returns the verb of the command echoed by lircd, such as SEND_ONCE.
+func (r CommandReply) Verb() string {
+	fields := strings.Fields(r.Command)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// Args returns the arguments of the command echoed by lircd, such as the remote
+// control and button name of a [SendOnce] command.
+func (r CommandReply) Args() []string {
+	fields := strings.Fields(r.Command)
+	if len(fields) < 2 {
+		return nil
+	}
+	return fields[1:]
+}
+
 // ErrUnsuccessfulCommand is returned with a reply when a command was not successful.
 var ErrUnsuccessfulCommand = errors.New("lirc: unsuccessful command")
+
+// Errors matched by a [CommandError] when lircd's error message is recognized.
+var (
+	// ErrUnknownRemote is matched when lircd does not know the remote control
+	// a command refers to.
+	ErrUnknownRemote = errors.New("lirc: unknown remote control")
+	// ErrUnknownButton is matched when the remote control does not have the
+	// button a command refers to.
+	ErrUnknownButton = errors.New("lirc: unknown button")
+	// ErrTransmitUnsupported is matched when the hardware lircd uses can only
+	// receive.
+	ErrTransmitUnsupported = errors.New("lirc: hardware does not support sending")
+	// ErrTransmitFailed is matched when the hardware failed to transmit.
+	ErrTransmitFailed = errors.New("lirc: transmission failed")
+	// ErrRepeating is matched when lircd can't send because it is repeating
+	// a button for a [SendStart] command.
+	ErrRepeating = errors.New("lirc: busy repeating")
+	// ErrSimulateDisabled is matched when lircd rejects a [Simulate] command
+	// because it wasn't started with --allow-simulate.
+	ErrSimulateDisabled = errors.New("lirc: simulate is disabled")
+)
+
+// CommandError is returned with a reply when lircd replied to a command with
+// ERROR. It matches [ErrUnsuccessfulCommand] as well as a more specific error
+// such as [ErrUnknownRemote] if lircd's message is recognized.
+type CommandError struct {
+	// Command is the command that failed.
+	Command string
+	// Message is the error message sent by lircd, if any.
+	Message string
+}
+
+func newCommandError(reply CommandReply) *CommandError {
+	return &CommandError{
+		Command: reply.Command,
+		Message: strings.TrimSpace(strings.Join(reply.Data, "\n")),
+	}
+}
+
+func (e *CommandError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s: %s", ErrUnsuccessfulCommand, e.Command)
+	}
+	return fmt.Sprintf("%s: %s: %s", ErrUnsuccessfulCommand, e.Command, e.Message)
+}
+
+func (e *CommandError) Unwrap() []error {
+	errs := []error{ErrUnsuccessfulCommand}
+	if known := knownCommandError(e.Message); known != nil {
+		errs = append(errs, known)
+	}
+	return errs
+}
+
+// Retryable implements the [Retryable] interface. lircd didn't transmit
+// anything if it was busy repeating a button or the transmission failed, so the
+// command may be sent again.
+func (e *CommandError) Retryable() bool {
+	known := knownCommandError(e.Message)
+	return known == ErrRepeating || known == ErrTransmitFailed
+}
+
+// knownCommandError maps an error message sent by lircd to the matching error.
+func knownCommandError(message string) error {
+	switch {
+	case strings.HasPrefix(message, "unknown remote"):
+		return ErrUnknownRemote
+	case strings.HasPrefix(message, "unknown command"):
+		// lircd calls buttons "commands" in its messages.
+		return ErrUnknownButton
+	case strings.HasPrefix(message, "hardware does not support sending"):
+		return ErrTransmitUnsupported
+	case strings.HasPrefix(message, "transmission failed"):
+		return ErrTransmitFailed
+	case strings.HasPrefix(message, "busy"):
+		return ErrRepeating
+	case strings.HasPrefix(message, "SIMULATE command is disabled"),
+		strings.HasPrefix(message, "SIMULATE not allowed"):
+		return ErrSimulateDisabled
+	default:
+		return nil
+	}
+}
+
+// PartialReplyError is returned when waiting for a reply failed, e.g. because
+// it timed out, after some of its DATA lines were received. It wraps the error
+// that ended the wait.
+type PartialReplyError struct {
+	// Command is the command whose reply was cut short.
+	Command string
+	// Data is the DATA lines received before the wait ended.
+	Data []string
+	Err  error
+}
+
+func (e *PartialReplyError) Error() string {
+	return fmt.Sprintf("partial reply to %s with %d data lines: %v", e.Command, len(e.Data), e.Err)
+}
+
+func (e *PartialReplyError) Unwrap() error {
+	return e.Err
+}
+
+// ErrSendDisabled is returned when sending a command on a receive-only
+// connection. See [WithReceiveOnly].
+var ErrSendDisabled = errors.New("lirc: sending is disabled on a receive-only connection")
+
+// ErrNotConnected is returned when the connection to lircd is gone before a
+// command could be sent or before its reply arrived.
+var ErrNotConnected = errors.New("lirc: not connected")
+
+// ErrReconnecting is returned when sending a command while the connection is
+// being reestablished, if [WithFailWhileReconnecting] is used. The command
+// wasn't sent.
+var ErrReconnecting = errors.New("lirc: reconnecting")
+
+// ErrReplyLost is returned when lircd's reply to a command was cut short by
+// another reply, meaning that at least part of the reply was lost. The command
+// may be retried.
+var ErrReplyLost = errors.New("lirc: reply lost")
+
+// ErrReplyTimeout is returned when lircd took too long to reply to a command.
+// The error also matches [context.DeadlineExceeded].
+var ErrReplyTimeout = errors.New("lirc: reply timed out")
+
+// ErrReplyTooLarge is returned when lircd's reply to a command has more DATA
+// lines than allowed by [WithMaxReplyLines]. The reply is discarded.
+var ErrReplyTooLarge = errors.New("lirc: reply too large")
@@ -0,0 +1,90 @@
+package lirc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrMalformedMode2 is sent by [ParseMode2] when a line isn't a valid mode2
+// line.
+var ErrMalformedMode2 = errors.New("lirc: malformed mode2 line")
+
+// PulseSpace is a pulse or space received by an IR receiver, as logged by
+// [SetInputLog] or printed by mode2(1).
+type PulseSpace struct {
+	// Pulse is whether the signal was on. It is false for spaces, which
+	// include the timeouts sent once a signal has ended.
+	Pulse bool
+	// Duration is how long the signal stayed on or off.
+	Duration time.Duration
+}
+
+// ParseMode2 decodes the pulses and spaces of a log written by lircd once
+// logging is started with [SetInputLog], or of the output of mode2(1). Each
+// line has the form
+//
+//	pulse|space|timeout <microseconds>
+//
+// Timeouts are sent as spaces. Empty lines and comments starting with # are
+// skipped. The pulses and spaces are sent on the returned channel, which is
+// closed once r is fully read or a line can't be parsed, and must be read
+// until then. The error channel then receives at most one error, which wraps
+// [ErrMalformedMode2] for malformed lines, before being closed.
+func ParseMode2(r io.Reader) (<-chan PulseSpace, <-chan error) {
+	pulses := make(chan PulseSpace)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(pulses)
+
+		scanner := bufio.NewScanner(r)
+		for n := 1; scanner.Scan(); n++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			p, err := parseMode2Line(line)
+			if err != nil {
+				errs <- fmt.Errorf("line %d: %w", n, err)
+				return
+			}
+			pulses <- p
+		}
+		if err := scanner.Err(); err != nil {
+			errs <- fmt.Errorf("error reading mode2 log: %w", err)
+		}
+	}()
+
+	return pulses, errs
+}
+
+func parseMode2Line(line string) (PulseSpace, error) {
+	kind, value, ok := strings.Cut(line, " ")
+	if !ok {
+		return PulseSpace{}, fmt.Errorf("%w: %q has no duration", ErrMalformedMode2, line)
+	}
+
+	var p PulseSpace
+	switch kind {
+	case "pulse":
+		p.Pulse = true
+	case "space", "timeout":
+	default:
+		return PulseSpace{}, fmt.Errorf("%w: unknown type %q", ErrMalformedMode2, kind)
+	}
+
+	us, err := strconv.ParseUint(strings.TrimSpace(value), 10, 32)
+	if err != nil {
+		return PulseSpace{}, fmt.Errorf("%w: duration %q is not a number", ErrMalformedMode2, value)
+	}
+	p.Duration = time.Duration(us) * time.Microsecond
+
+	return p, nil
+}
@@ -0,0 +1,48 @@
+package lirc
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestParseMode2(t *testing.T) {
+	collect := func(pulses <-chan PulseSpace, errs <-chan error) ([]PulseSpace, error) {
+		var all []PulseSpace
+		for p := range pulses {
+			all = append(all, p)
+		}
+		return all, <-errs
+	}
+
+	f, err := os.Open("testdata/mode2/samsung-power.log")
+	assert.NoError(t, err)
+	defer f.Close()
+
+	us := func(n time.Duration) time.Duration { return n * time.Microsecond }
+
+	pulses, err := collect(ParseMode2(f))
+	assert.NoError(t, err)
+	assert.Equal(t, []PulseSpace{
+		{Pulse: false, Duration: us(16777215)},
+		{Pulse: true, Duration: us(4512)},
+		{Pulse: false, Duration: us(4471)},
+		{Pulse: true, Duration: us(598)},
+		{Pulse: false, Duration: us(1671)},
+		{Pulse: true, Duration: us(573)},
+		{Pulse: false, Duration: us(546)},
+		{Pulse: true, Duration: us(601)},
+		{Pulse: false, Duration: us(1665)},
+		{Pulse: false, Duration: us(125012)},
+	}, pulses)
+
+	for _, line := range []string{"pulse", "pulse abc", "pulse -1", "code 0x10"} {
+		pulses, err := collect(ParseMode2(strings.NewReader("pulse 100\n" + line + "\nspace 100\n")))
+		assert.IsError(t, err, ErrMalformedMode2, line)
+		assert.Contains(t, err.Error(), "line 2", line)
+		assert.Equal(t, []PulseSpace{{Pulse: true, Duration: us(100)}}, pulses, "stops at the malformed line")
+	}
+}
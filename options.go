@@ -0,0 +1,452 @@
+package lirc
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// Option configures a [Connection].
+type Option func(*options)
+
+type options struct {
+	clock          clock
+	reloadLogLevel slog.Level
+	receiveOnly    bool
+	splitFunc      bufio.SplitFunc
+	pipelineDepth  int
+
+	errorLogThrottle      time.Duration
+	connEvents            bool
+	repeatFilter          uint
+	dedupWindow           time.Duration
+	coalesceWindow        time.Duration
+	rawEvents             bool
+	eventLogging          bool
+	eventTap              chan<- ButtonPress
+	subscriberBufferLimit int
+	shrinkSubscribers     bool
+	codeWidth             int
+
+	tcpNoDelay   bool
+	tcpKeepAlive time.Duration
+
+	warmup         bool
+	defaultRepeats uint
+
+	autoStart       context.Context
+	autoStartLogger *slog.Logger
+	idleTimeout     time.Duration
+	replyMatcher    func(command Command, echoed string) bool
+	commandPrefix   []string
+	commandEncoder  func(args []string) string
+	commandLog      io.Writer
+	allowedRemotes  []string
+	historySize     int
+
+	writeTimeout          time.Duration
+	reconnectDelay        time.Duration
+	reconnectGrace        time.Duration
+	maxConnectAttempts    int
+	failWhileReconnecting bool
+	maxReplyLines         int
+	retries               int
+}
+
+func defaultOptions() options {
+	return options{
+		clock:          realClock{},
+		reloadLogLevel: slog.LevelInfo,
+		splitFunc:      bufio.ScanLines,
+		pipelineDepth:  1,
+
+		errorLogThrottle: 10 * time.Second,
+		codeWidth:        16,
+
+		replyMatcher: matchReplyVerb,
+		writeTimeout: 5 * time.Second,
+
+		maxReplyLines: 1 << 16,
+
+		tcpNoDelay:   true,
+		tcpKeepAlive: 15 * time.Second,
+	}
+}
+
+// withClock sets the clock used by the connection. It is used by tests.
+func withClock(c clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithReloadLogLevel sets the level at which lircd reloads (SIGHUP) are logged.
+// The default is [slog.LevelInfo].
+func WithReloadLogLevel(level slog.Level) Option {
+	return func(o *options) {
+		o.reloadLogLevel = level
+	}
+}
+
+// WithReceiveOnly makes the connection receive-only. SendCommand always fails
+// with [ErrSendDisabled], and Start never writes to lircd, so it only runs the
+// goroutine that reads from it. Events are still received as usual.
+func WithReceiveOnly() Option {
+	return func(o *options) {
+		o.receiveOnly = true
+	}
+}
+
+// WithSplitFunc sets the function used to split the data read from lircd into
+// protocol lines. It is an escape hatch for servers that frame lines
+// differently; each token returned by split must be exactly one protocol line
+// without its delimiter. Commands are still written newline-terminated. The
+// default is [bufio.ScanLines].
+func WithSplitFunc(split bufio.SplitFunc) Option {
+	return func(o *options) {
+		o.splitFunc = split
+	}
+}
+
+// WithPipelining allows up to depth commands to be written to lircd before
+// their replies arrive. Replies are matched to commands in the order the
+// commands were sent. Only enable this if the server handles overlapping
+// commands; stock lircd processes one command at a time. The default depth is
+// 1, meaning each command waits for the previous command's reply.
+func WithPipelining(depth int) Option {
+	return func(o *options) {
+		o.pipelineDepth = depth
+	}
+}
+
+// WithErrorLogThrottle sets the window in which identical errors about
+// malformed lines from lircd are logged only once. The next time the error is
+// logged after the window, the log includes how many times it was suppressed.
+// A window of 0 logs every error. The default is 10 seconds.
+func WithErrorLogThrottle(window time.Duration) Option {
+	return func(o *options) {
+		o.errorLogThrottle = window
+	}
+}
+
+// WithConnEvents makes the connection send events on [Connection.ConnEvents]
+// instead of [Connection.Events]. Each [Event] carries the connection it came
+// from, which is useful when handling events from multiple connections.
+func WithConnEvents() Option {
+	return func(o *options) {
+		o.connEvents = true
+	}
+}
+
+// WithRepeatFilter makes the connection only deliver every keepEvery-th
+// repeat of a held button, which is plenty for e.g. volume buttons. The first
+// press, which has a repeat count of 0, is always delivered. The default of 0
+// delivers every repeat.
+func WithRepeatFilter(keepEvery uint) Option {
+	return func(o *options) {
+		o.repeatFilter = keepEvery
+	}
+}
+
+// WithDedup makes the connection drop button presses that are identical to one
+// received less than window ago, meaning that they have the same remote
+// control, button, code and repeat count, such as those replayed by lircd
+// around a reconnection. Held buttons aren't affected since their repeat count
+// changes, but pressing the same button again within window is dropped as
+// well, so keep window short. The default of 0 keeps every press.
+func WithDedup(window time.Duration) Option {
+	return func(o *options) {
+		o.dedupWindow = window
+	}
+}
+
+// WithCoalescing makes the connection collapse the repeats of a held button
+// received within window into a single button press with the highest repeat
+// count, which is delivered once window has passed since the first of them.
+// This reduces the number of events of fast-repeating remote controls while
+// keeping the latest state of the button. The first press of a button, which
+// has a repeat count of 0, is always delivered right away, as is the last
+// repeat of a button before another button is pressed. Subscribers and
+// [Connection.History] still see every press. The default of 0 delivers every
+// repeat.
+func WithCoalescing(window time.Duration) Option {
+	return func(o *options) {
+		o.coalesceWindow = window
+	}
+}
+
+// WithRawEvents makes the connection set [ButtonPress.Raw] to the line lircd
+// sent for each event, which helps when debugging remote controls with
+// surprising names or codes.
+func WithRawEvents() Option {
+	return func(o *options) {
+		o.rawEvents = true
+	}
+}
+
+// WithEventLogging makes the connection log every button press received from
+// lircd at debug level, with its remote control, button, code and repeat count
+// as attributes, much like irw(1) prints them.
+func WithEventLogging() Option {
+	return func(o *options) {
+		o.eventLogging = true
+	}
+}
+
+// WithEventTap makes the connection also send every button press received from
+// lircd to ch, such as for audit logging, including the ones dropped by
+// [WithDedup] or [WithRepeatFilter] and before [WithCoalescing] merges them.
+// Presses are still delivered as usual. Sending to ch never blocks: presses are
+// dropped if ch is full.
+func WithEventTap(ch chan<- ButtonPress) Option {
+	return func(o *options) {
+		o.eventTap = ch
+	}
+}
+
+// WithSubscriberBufferLimit caps the number of events that the buffers of all
+// subscribers of the connection can hold together, which bounds the memory
+// used when there are many subscribers. Each subscriber has room for 16
+// events, so the limit is reached after n/16 subscribers. At that point,
+// [Connection.TrySubscribe] fails with [ErrTooManySubscribers], unless
+// [WithShrinkingSubscribers] is used. Unsubscribing frees the buffer up for new
+// subscribers. The default of 0 has no limit.
+func WithSubscriberBufferLimit(n int) Option {
+	return func(o *options) {
+		o.subscriberBufferLimit = n
+	}
+}
+
+// WithShrinkingSubscribers makes new subscribers get a smaller buffer once the
+// limit set by [WithSubscriberBufferLimit] is reached, instead of being
+// rejected: the first gets whatever room is left, and the ones after it get an
+// unbuffered channel, which only receives the events published while it is
+// being read from.
+func WithShrinkingSubscribers() Option {
+	return func(o *options) {
+		o.shrinkSubscribers = true
+	}
+}
+
+// WithCodeWidth sets the number of hexadecimal digits that button codes
+// received from lircd may have. Events with longer codes are dropped as
+// malformed, as are codes that don't fit in 64 bits no matter the width. The
+// default is 16, which is what lircd sends, and is also used if width is 0 or
+// less.
+func WithCodeWidth(width int) Option {
+	return func(o *options) {
+		if width <= 0 {
+			width = defaultOptions().codeWidth
+		}
+		o.codeWidth = width
+	}
+}
+
+// WithTCPNoDelay sets whether TCP_NODELAY is set on connections made by
+// [NewTCP]. Commands are small and latency-sensitive, so the default is true.
+func WithTCPNoDelay(noDelay bool) Option {
+	return func(o *options) {
+		o.tcpNoDelay = noDelay
+	}
+}
+
+// WithTCPKeepAlive sets the idle time after which the OS starts sending TCP
+// keepalive probes on connections made by [NewTCP], so that dead connections
+// are detected. A negative idle time disables keepalive. The default is 15
+// seconds.
+func WithTCPKeepAlive(idle time.Duration) Option {
+	return func(o *options) {
+		o.tcpKeepAlive = idle
+	}
+}
+
+// WithWarmup makes the connection fetch the lircd version and the buttons of
+// every remote control each time it connects, so that they're available from
+// [Connection.ServerVersion], [Connection.Capabilities] and
+// [Connection.Catalog] right away. The connection isn't reported as connected
+// until the first attempt is done. If it fails, the error is logged and
+// fetching is retried in the background.
+func WithWarmup() Option {
+	return func(o *options) {
+		o.warmup = true
+	}
+}
+
+// WithDefaultRepeats sets the number of repeats used for [SendOnce] commands
+// that don't specify any, instead of letting lircd use the remote control's
+// minimum. Commands that set [SendOnce.Repeats] still use their own value.
+func WithDefaultRepeats(n uint) Option {
+	return func(o *options) {
+		o.defaultRepeats = n
+	}
+}
+
+// WithAutoStart makes the connection start itself in the background the first
+// time a command is sent, so that calling [Connection.Start] isn't needed. The
+// command waits until the connection is established or fails to be. If the
+// connection is lost, the next command starts it again. The connection runs
+// until ctx is done or [Connection.Close] is called. Logs are written to
+// logger, or to [slog.Default] if it is nil.
+func WithAutoStart(ctx context.Context, logger *slog.Logger) Option {
+	return func(o *options) {
+		o.autoStart = ctx
+		o.autoStartLogger = logger
+	}
+}
+
+// WithIdleTimeout makes the connection close itself once no command was sent
+// and nothing was received for d, in which case [Connection.Start] returns
+// [ErrIdleTimeout]. Combined with [WithAutoStart], the next command opens the
+// connection again. The default of 0 never closes idle connections.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.idleTimeout = d
+	}
+}
+
+// WithReplyMatcher sets the function that checks that a reply is for the
+// command it was received for, given the command line echoed in the reply.
+// Commands whose reply doesn't match fail with an error. This is an escape
+// hatch for servers that echo commands differently. The default compares the
+// verb of the command with the first word of the echo, ignoring case.
+func WithReplyMatcher(match func(command Command, echoed string) bool) Option {
+	return func(o *options) {
+		o.replyMatcher = match
+	}
+}
+
+// WithCommandPrefix makes the connection write the given tokens before every
+// command it sends, separated by spaces, for proxies in front of lircd that
+// route commands by a prefix such as a seat or session name. Replies may echo
+// the command with or without the prefix. Lines written by
+// [Connection.WriteRaw] aren't prefixed. Commands fail with
+// [ErrInvalidCommand] if a token is empty or has spaces or line breaks.
+func WithCommandPrefix(args ...string) Option {
+	return func(o *options) {
+		o.commandPrefix = append([]string{}, args...)
+	}
+}
+
+// WithCommandEncoder sets the function that joins the arguments of each
+// command, including the verb and any [WithCommandPrefix] tokens, into the line
+// written to lircd, without its trailing newline. This is an escape hatch for
+// lircd forks that expect quoted arguments, such as names with spaces. Since
+// the encoder decides how arguments are delimited, commands are then only
+// checked to have a verb and to encode to a single line. The default joins the
+// arguments with spaces and rejects arguments that have spaces.
+func WithCommandEncoder(encode func(args []string) string) Option {
+	return func(o *options) {
+		o.commandEncoder = encode
+	}
+}
+
+// WithCommandLog makes the connection write a timestamped line to w for every
+// command it sends to lircd and every reply it receives, with the success of
+// the reply and its number of DATA lines, as a transcript for audit trails.
+// Lines written by [Connection.WriteRaw] aren't logged. Errors writing to w are
+// ignored.
+func WithCommandLog(w io.Writer) Option {
+	return func(o *options) {
+		o.commandLog = w
+	}
+}
+
+// WithAllowedRemotes only allows sending with the given remote controls. Send
+// commands, such as [SendOnce] and the ones sent by [Connection.RepeatButton],
+// fail with [ErrRemoteNotAllowed] without being sent if they use any other
+// remote control. Other commands aren't affected. By default, every remote
+// control is allowed.
+func WithAllowedRemotes(names ...string) Option {
+	return func(o *options) {
+		o.allowedRemotes = append([]string{}, names...)
+	}
+}
+
+// WithHistory makes the connection keep the last n button presses it
+// delivered, which are returned by [Connection.History]. Presses dropped by
+// [WithRepeatFilter] aren't kept. The default of 0 keeps none.
+func WithHistory(n int) Option {
+	return func(o *options) {
+		o.historySize = n
+	}
+}
+
+// WithWriteTimeout sets how long writing a command to lircd may take. If a
+// write fails or times out, lircd may have received part of the command, so the
+// connection is closed as broken and [Connection.Start] returns the error; see
+// [WithReconnect]. A timeout of 0 disables it. The default is 5 seconds.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.writeTimeout = d
+	}
+}
+
+// WithReconnect makes [Connection.Start] connect to lircd again, after waiting
+// for delay, whenever the connection is lost or fails to be established,
+// instead of returning. Start then only returns once its context is done or the
+// connection was closed by [WithIdleTimeout]. The default of 0 never
+// reconnects.
+func WithReconnect(delay time.Duration) Option {
+	return func(o *options) {
+		o.reconnectDelay = delay
+	}
+}
+
+// WithReconnectGrace makes [Connection.Start] quietly try to connect to lircd
+// again for up to d once the connection is lost, such as when lircd is quickly
+// restarted, before treating the loss as a failure. Errors aren't reported on
+// [Connection.Errors] in the meantime. Once d is over, Start returns, or
+// reconnects as set by [WithReconnect]. The default of 0 has no grace period.
+func WithReconnectGrace(d time.Duration) Option {
+	return func(o *options) {
+		o.reconnectGrace = d
+	}
+}
+
+// WithMaxConnectAttempts makes [Connection.Start] give up reconnecting once
+// connecting to lircd failed n times in a row, in which case it returns an error
+// listing the error of each attempt. A lost connection that is reestablished
+// within the grace period set by [WithReconnectGrace] doesn't count as a
+// failure. It only matters with [WithReconnect]. The default of 0 never gives
+// up.
+func WithMaxConnectAttempts(n int) Option {
+	return func(o *options) {
+		o.maxConnectAttempts = n
+	}
+}
+
+// WithFailWhileReconnecting makes commands sent while [Connection.Start] is
+// reestablishing a lost connection fail with [ErrReconnecting] instead of
+// waiting until the connection is back, which is the default. It only matters
+// with [WithReconnect] or [WithReconnectGrace].
+func WithFailWhileReconnecting() Option {
+	return func(o *options) {
+		o.failWhileReconnecting = true
+	}
+}
+
+// WithMaxReplyLines sets the largest number of DATA lines accepted in a reply
+// from lircd. Commands whose reply has more fail with [ErrReplyTooLarge], and
+// the reply is skipped. The default is 65536, which is more than any remote
+// control configuration needs, and is also used if n is 0 or less.
+func WithMaxReplyLines(n int) Option {
+	return func(o *options) {
+		if n <= 0 {
+			n = defaultOptions().maxReplyLines
+		}
+		o.maxReplyLines = n
+	}
+}
+
+// WithRetries makes [Connection.SendCommand] send idempotent commands, such as
+// [List] and the ones marked with [Idempotent], up to n more times if their
+// reply is lost, the connection is lost before it arrives or lircd takes too
+// long to send it. Other commands are never retried, since lircd may have
+// already transmitted them. The default of 0 never retries.
+func WithRetries(n int) Option {
+	return func(o *options) {
+		o.retries = n
+	}
+}
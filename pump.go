@@ -0,0 +1,50 @@
+package lirc
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// Pump reads the lircd protocol from conn until it is closed or ctx is done,
+// sending button presses to events and command replies to replies. It is the
+// reader used by [Connection.Start], for when the connection to lircd is
+// managed elsewhere, e.g. when proxying or recording it. Pump never writes to
+// conn, so every reply is sent to replies as it arrives. A nil channel drops
+// that kind of message.
+//
+// Pump returns nil once conn is closed by the other end, ctx.Err() once ctx is
+// done, and the read error otherwise.
+func Pump(ctx context.Context, conn net.Conn, events chan<- ButtonPress, replies chan<- CommandReply, logger *slog.Logger) error {
+	opts := defaultOptions()
+
+	reader := newLircReader(logger, &opts, func(ctx context.Context, event ButtonPress) {
+		if events == nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+		case events <- event:
+		}
+	}, nil)
+	reader.unclaimed = func(ctx context.Context, reply CommandReply) {
+		if replies == nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+		case replies <- reply:
+		}
+	}
+
+	// Interrupt the blocked read once ctx is done.
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	err := reader.pump(ctx, conn)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
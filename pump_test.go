@@ -0,0 +1,58 @@
+package lirc
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/neilotoole/slogt"
+)
+
+func TestPump(t *testing.T) {
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+
+	go func() {
+		defer server.Close()
+		io.WriteString(server, "0000000000f40bf0 00 KEY_VOLUMEUP samsung\n"+
+			"BEGIN\nVERSION\nSUCCESS\nDATA\n1\n0.10.1\nEND\n"+
+			"0000000000f40bf0 01 KEY_VOLUMEUP samsung\n")
+	}()
+
+	events := make(chan ButtonPress, 2)
+	replies := make(chan CommandReply, 1)
+	err := Pump(context.Background(), client, events, replies, slogt.New(t))
+	assert.NoError(t, err, "pump stops once the connection is closed")
+
+	assert.Equal(t, ButtonPress{
+		Code:              0xf40bf0,
+		ButtonName:        "KEY_VOLUMEUP",
+		RemoteControlName: "samsung",
+	}, <-events)
+	assert.Equal(t, ButtonPress{
+		Code:              0xf40bf0,
+		RepeatCount:       1,
+		ButtonName:        "KEY_VOLUMEUP",
+		RemoteControlName: "samsung",
+	}, <-events)
+	assert.Equal(t, CommandReply{
+		Command: "VERSION",
+		Status:  StatusSuccess,
+		Success: true,
+		Data:    []string{"0.10.1"},
+	}, <-replies)
+}
+
+func TestPumpCanceled(t *testing.T) {
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close(); server.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Pump(ctx, client, nil, nil, slogt.New(t)) }()
+
+	cancel()
+	assert.IsError(t, <-done, context.Canceled)
+}
@@ -0,0 +1,151 @@
+package lirc
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrQueueFull is returned by [SendQueue.Send] when the queue's backlog is
+// already full.
+var ErrQueueFull = errors.New("lirc: send queue is full")
+
+// SendQueue queues commands sent to a [Connection] in FIFO order. lircd only
+// handles one command at a time, so callers sharing a connection wait for
+// their turn in the queue instead of racing each other for it.
+type SendQueue struct {
+	conn    *Connection
+	backlog int
+
+	mu      sync.Mutex
+	waiters []chan struct{}
+	busy    bool
+	stats   SendQueueStats
+}
+
+// SendQueueStats contains metrics about a [SendQueue].
+type SendQueueStats struct {
+	// Depth is the number of commands that are either waiting in the queue or
+	// currently being sent.
+	Depth int
+	// Sent is the number of commands that were handed to the connection.
+	Sent uint64
+	// Rejected is the number of commands rejected with [ErrQueueFull].
+	Rejected uint64
+	// TotalWait is the total time commands spent waiting in the queue.
+	TotalWait time.Duration
+	// MaxWait is the longest time a single command spent waiting in the queue.
+	MaxWait time.Duration
+}
+
+// NewSendQueue creates a new SendQueue that sends commands to conn. backlog is
+// the maximum number of commands that may wait behind the one currently being
+// sent before [SendQueue.Send] fails with [ErrQueueFull].
+func NewSendQueue(conn *Connection, backlog int) *SendQueue {
+	return &SendQueue{
+		conn:    conn,
+		backlog: backlog,
+	}
+}
+
+// Send waits for its turn in the queue and then sends the command. It returns
+// [ErrQueueFull] without waiting if the backlog is full.
+func (q *SendQueue) Send(ctx context.Context, command Command) (CommandReply, error) {
+	clock := q.conn.opts.clock
+	start := clock.Now()
+
+	if err := q.acquire(ctx); err != nil {
+		return CommandReply{}, err
+	}
+	defer q.release()
+
+	wait := clock.Now().Sub(start)
+
+	q.mu.Lock()
+	q.stats.Sent++
+	q.stats.TotalWait += wait
+	q.stats.MaxWait = max(q.stats.MaxWait, wait)
+	q.mu.Unlock()
+
+	return q.conn.SendCommand(ctx, command)
+}
+
+// Depth returns the number of commands that are either waiting in the queue or
+// currently being sent.
+func (q *SendQueue) Depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.depth()
+}
+
+// Stats returns a snapshot of the queue's metrics.
+func (q *SendQueue) Stats() SendQueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := q.stats
+	stats.Depth = q.depth()
+	return stats
+}
+
+func (q *SendQueue) depth() int {
+	if !q.busy {
+		return 0
+	}
+	return len(q.waiters) + 1
+}
+
+func (q *SendQueue) acquire(ctx context.Context) error {
+	q.mu.Lock()
+
+	if !q.busy {
+		q.busy = true
+		q.mu.Unlock()
+		return nil
+	}
+
+	if len(q.waiters) >= q.backlog {
+		q.stats.Rejected++
+		q.mu.Unlock()
+		return ErrQueueFull
+	}
+
+	turn := make(chan struct{})
+	q.waiters = append(q.waiters, turn)
+	q.mu.Unlock()
+
+	select {
+	case <-turn:
+		return nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		i := slices.Index(q.waiters, turn)
+		if i != -1 {
+			q.waiters = slices.Delete(q.waiters, i, i+1)
+		}
+		q.mu.Unlock()
+
+		if i == -1 {
+			// We were given our turn just as ctx was done, so pass it on to the
+			// next caller.
+			q.release()
+		}
+
+		return ctx.Err()
+	}
+}
+
+func (q *SendQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.waiters) == 0 {
+		q.busy = false
+		return
+	}
+
+	close(q.waiters[0])
+	q.waiters = q.waiters[1:]
+}
@@ -0,0 +1,109 @@
+package lirc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestSendQueue(t *testing.T) {
+	const producers = 8
+
+	release := make(chan struct{})
+	srv := newMockServer(t, func(line string) []string {
+		if line == "SEND_ONCE remote button0" {
+			<-release
+		}
+		return mockSuccess(line)
+	})
+
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+
+	queue := NewSendQueue(conn, producers-1)
+
+	var wg sync.WaitGroup
+	errs := make([]error, producers)
+	for i := range producers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = queue.Send(ctx, SendOnce{RemoteControl: "remote", ButtonName: fmt.Sprintf("button%d", i)})
+		}()
+
+		// Wait for the producer to be queued before starting the next one, so
+		// that the expected order is known.
+		eventually(t, func() bool { return queue.Depth() == i+1 }, "producer to queue")
+	}
+
+	_, err := queue.Send(ctx, SendOnce{RemoteControl: "remote", ButtonName: "overflow"})
+	assert.IsError(t, err, ErrQueueFull, "backlog is full")
+
+	close(release)
+	wg.Wait()
+
+	for i, err := range errs {
+		assert.NoError(t, err, "producer %d", i)
+	}
+
+	var expected []string
+	for i := range producers {
+		expected = append(expected, fmt.Sprintf("SEND_ONCE remote button%d", i))
+	}
+	assert.Equal(t, expected, srv.received(), "commands are sent in FIFO order")
+
+	stats := queue.Stats()
+	assert.Equal(t, 0, stats.Depth, "queue is drained")
+	assert.Equal(t, uint64(producers), stats.Sent, "sent count")
+	assert.Equal(t, uint64(1), stats.Rejected, "rejected count")
+	assert.True(t, stats.MaxWait > 0, "max wait is recorded")
+}
+
+func TestSendQueueCancel(t *testing.T) {
+	release := make(chan struct{})
+	srv := newMockServer(t, func(line string) []string {
+		if strings.HasSuffix(line, "first") {
+			<-release
+		}
+		return mockSuccess(line)
+	})
+
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+
+	queue := NewSendQueue(conn, 2)
+
+	done := make(chan error)
+	go func() {
+		_, err := queue.Send(ctx, SendOnce{RemoteControl: "remote", ButtonName: "first"})
+		done <- err
+	}()
+	eventually(t, func() bool { return queue.Depth() == 1 }, "first command to be sent")
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	canceled := make(chan error)
+	go func() {
+		_, err := queue.Send(cancelCtx, SendOnce{RemoteControl: "remote", ButtonName: "canceled"})
+		canceled <- err
+	}()
+	eventually(t, func() bool { return queue.Depth() == 2 }, "second command to queue")
+
+	cancel()
+	assert.IsError(t, <-canceled, context.Canceled, "canceled caller leaves the queue")
+	assert.Equal(t, 1, queue.Depth(), "canceled caller is removed")
+
+	close(release)
+	assert.NoError(t, <-done, "first command")
+
+	_, err := queue.Send(ctx, SendOnce{RemoteControl: "remote", ButtonName: "last"})
+	assert.NoError(t, err, "queue is usable after a cancellation")
+
+	assert.Equal(t,
+		[]string{"SEND_ONCE remote first", "SEND_ONCE remote last"},
+		srv.received(),
+		"canceled command is never sent")
+}
@@ -0,0 +1,85 @@
+package lirc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+)
+
+// rawFrameBuffer is the number of unread replies kept for ReadRawFrame. Any
+// more are dropped.
+const rawFrameBuffer = 16
+
+// WriteRaw writes b to lircd as-is, bypassing command encoding. It is a
+// low-level escape hatch for probing servers that speak a different dialect
+// of the protocol; b should normally end with a newline. The replies that b
+// causes aren't matched to any command, so they can be read with
+// [Connection.ReadRawFrame]. Writes are ordered with commands, but commands
+// sent before the replies to b arrive will receive them instead.
+func (l *Connection) WriteRaw(ctx context.Context, b []byte) error {
+	if l.opts.receiveOnly {
+		return ErrSendDisabled
+	}
+
+	if l.opts.autoStart != nil {
+		if err := l.autoStart(ctx); err != nil {
+			return err
+		}
+	}
+
+	pending := &pendingCommand{
+		raw:    b,
+		result: make(chan commandResult, 1),
+		done:   make(chan struct{}),
+	}
+	defer close(pending.done)
+
+	l.seqMu.Lock()
+	err := l.enqueue(ctx, pending)
+	l.seqMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("error writing raw bytes: %w", ctx.Err())
+	case result := <-pending.result:
+		return result.err
+	}
+}
+
+// ReadRawFrame returns the next reply packet from lircd that wasn't a reply to
+// any command, such as one caused by [Connection.WriteRaw]. It blocks until one
+// is received or ctx is done. Packets received while a few others are still
+// unread are dropped.
+func (l *Connection) ReadRawFrame(ctx context.Context) (CommandReply, error) {
+	select {
+	case <-ctx.Done():
+		return CommandReply{}, ctx.Err()
+	case frame := <-l.rawFrames:
+		return frame, nil
+	}
+}
+
+// writeRaw writes the raw bytes of pending to conn and reports the outcome to
+// it.
+func (l *Connection) writeRaw(logger *slog.Logger, conn net.Conn, pending *pendingCommand) error {
+	logger.Debug(
+		"writing raw bytes to lircd",
+		"len", len(pending.raw))
+
+	if err := l.write(conn, pending.raw); err != nil {
+		logger.Error(
+			"error writing to lircd socket",
+			"err", err)
+
+		err = fmt.Errorf("error writing raw bytes: %w", err)
+		pending.result <- commandResult{err: err}
+		return err
+	}
+
+	pending.result <- commandResult{}
+	return nil
+}
@@ -0,0 +1,36 @@
+package lirc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestWriteRaw(t *testing.T) {
+	srv := newMockServer(t, func(line string) []string {
+		return mockReply(line, true, "echo: "+line)
+	})
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+
+	assert.NoError(t, conn.WriteRaw(ctx, []byte("PROBE 1\n")))
+
+	frame, err := conn.ReadRawFrame(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, CommandReply{
+		Command: "PROBE 1",
+		Status:  StatusSuccess,
+		Success: true,
+		Data:    []string{"echo: PROBE 1"},
+	}, frame, "reply to the raw bytes")
+
+	_, err = conn.SendCommand(ctx, Version{})
+	assert.NoError(t, err, "commands still work afterwards")
+	assert.Equal(t, []string{"PROBE 1", "VERSION"}, srv.received())
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = conn.ReadRawFrame(ctx)
+	assert.IsError(t, err, context.Canceled, "no more frames")
+}
@@ -0,0 +1,48 @@
+package lirc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// graceRetryInterval is how often lircd is dialed during the grace period set
+// by WithReconnectGrace.
+const graceRetryInterval = 50 * time.Millisecond
+
+// redial dials lircd again after the connection was lost, retrying quietly
+// until the grace period is over. Only the last error is reported.
+func (r *Connection) redial(ctx context.Context) (net.Conn, error) {
+	deadline := r.opts.clock.Now().Add(r.opts.reconnectGrace)
+	for {
+		conn, err := r.dialer(ctx)
+		if err == nil {
+			return conn, nil
+		}
+
+		wait := min(graceRetryInterval, deadline.Sub(r.opts.clock.Now()))
+		if wait <= 0 || ctx.Err() != nil {
+			err = wrapDialError(err)
+			r.reportError(err)
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		case <-r.opts.clock.After(wait):
+		}
+	}
+}
+
+// connectAttemptsError returns the error returned by Start once it gives up
+// connecting to lircd, which lists the error of every failed attempt.
+func connectAttemptsError(failed []error) error {
+	errs := make([]error, len(failed))
+	for i, err := range failed {
+		errs[i] = fmt.Errorf("attempt %d: %w", i+1, err)
+	}
+	return fmt.Errorf("lirc: giving up after %d failed connect attempts:\n%w", len(failed), errors.Join(errs...))
+}
@@ -0,0 +1,149 @@
+package lirc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/neilotoole/slogt"
+)
+
+func TestReconnectGrace(t *testing.T) {
+	var dials atomic.Int32
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(func(ctx context.Context) (net.Conn, error) {
+		// lircd isn't listening yet right after it went away.
+		if dials.Add(1) == 2 {
+			return nil, &net.OpError{Op: "dial", Net: "unix", Err: syscall.ECONNREFUSED}
+		}
+		return srv.dial(ctx)
+	}, []Option{WithReconnectGrace(time.Second)})
+	ctx := startTestConnection(t, conn)
+	assert.NoError(t, conn.WaitConnected(ctx))
+
+	srv.hangup()
+	eventually(t, func() bool { return dials.Load() == 3 && conn.Connected() }, "reconnect")
+
+	_, err := conn.SendCommand(ctx, Version{})
+	assert.NoError(t, err, "connection is usable again")
+
+	select {
+	case err := <-conn.Errors():
+		t.Fatal("error surfaced during the grace period:", err)
+	default:
+	}
+}
+
+func TestMaxConnectAttempts(t *testing.T) {
+	var dials atomic.Int32
+	conn := newConnection(func(context.Context) (net.Conn, error) {
+		dials.Add(1)
+		return nil, &net.OpError{Op: "dial", Net: "unix", Err: syscall.ECONNREFUSED}
+	}, []Option{WithReconnect(time.Millisecond), WithMaxConnectAttempts(3)})
+
+	err := conn.Start(context.Background(), slogt.New(t))
+	assert.IsError(t, err, syscall.ECONNREFUSED)
+	assert.Equal(t, int32(3), dials.Load(), "gives up after the last attempt")
+	assert.Contains(t, err.Error(), "giving up after 3 failed connect attempts")
+	for _, attempt := range []string{"attempt 1: ", "attempt 2: ", "attempt 3: "} {
+		assert.Contains(t, err.Error(), attempt, "error lists every attempt")
+	}
+}
+
+func TestSendWhileReconnecting(t *testing.T) {
+	// reconnectingConnection returns a connection whose lircd goes away after
+	// connecting, and the function to bring lircd back.
+	reconnectingConnection := func(t *testing.T, opts ...Option) (*Connection, context.Context, *fakeClock, func()) {
+		var down atomic.Bool
+		clock := newFakeClock()
+		srv := newMockServer(t, mockSuccess)
+		conn := newConnection(func(ctx context.Context) (net.Conn, error) {
+			if down.Load() {
+				return nil, &net.OpError{Op: "dial", Net: "unix", Err: syscall.ECONNREFUSED}
+			}
+			return srv.dial(ctx)
+		}, append([]Option{WithReconnect(time.Second), withClock(clock)}, opts...))
+		ctx := startTestConnection(t, conn)
+		assert.NoError(t, conn.WaitConnected(ctx))
+
+		down.Store(true)
+		srv.hangup()
+		eventually(t, func() bool { return !conn.Connected() && clock.HasTimer(time.Second) }, "waiting to reconnect")
+
+		return conn, ctx, clock, func() { down.Store(false) }
+	}
+
+	t.Run("wait", func(t *testing.T) {
+		conn, ctx, clock, up := reconnectingConnection(t)
+
+		result := make(chan error, 1)
+		go func() {
+			_, err := conn.SendCommand(ctx, Version{})
+			result <- err
+		}()
+
+		select {
+		case err := <-result:
+			t.Fatal("command returned while reconnecting:", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		up()
+		clock.Advance(time.Second)
+		assert.NoError(t, <-result, "command is sent once reconnected")
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		conn, ctx, clock, up := reconnectingConnection(t, WithFailWhileReconnecting())
+
+		_, err := conn.SendCommand(ctx, Version{})
+		assert.IsError(t, err, ErrReconnecting)
+
+		up()
+		clock.Advance(time.Second)
+		assert.NoError(t, conn.WaitConnected(ctx))
+
+		_, err = conn.SendCommand(ctx, Version{})
+		assert.NoError(t, err, "commands are sent again once reconnected")
+	})
+}
+
+func TestWarmupAfterReconnect(t *testing.T) {
+	var down atomic.Bool
+	var versions atomic.Int32
+	clock := newFakeClock()
+	catalog := mockCatalog(nil, nil)
+	srv := newMockServer(t, func(line string) []string {
+		if line == "VERSION" {
+			return mockReply(line, true, fmt.Sprintf("0.10.%d", versions.Add(1)))
+		}
+		return catalog(line)
+	})
+	conn := newConnection(func(ctx context.Context) (net.Conn, error) {
+		if down.Load() {
+			return nil, &net.OpError{Op: "dial", Net: "unix", Err: syscall.ECONNREFUSED}
+		}
+		return srv.dial(ctx)
+	}, []Option{WithReconnect(time.Second), WithFailWhileReconnecting(), WithWarmup(), withClock(clock)})
+	ctx := startTestConnection(t, conn)
+	assert.NoError(t, conn.WaitConnected(ctx))
+
+	version, _ := conn.ServerVersion()
+	assert.Equal(t, "0.10.1", version)
+
+	down.Store(true)
+	srv.hangup()
+	eventually(t, func() bool { return !conn.Connected() && clock.HasTimer(time.Second) }, "waiting to reconnect")
+
+	down.Store(false)
+	clock.Advance(time.Second)
+	assert.NoError(t, conn.WaitConnected(ctx))
+
+	version, _ = conn.ServerVersion()
+	assert.Equal(t, "0.10.2", version, "warmup runs again after reconnecting")
+}
@@ -0,0 +1,32 @@
+package lirc
+
+import "context"
+
+// WaitForReload blocks until lircd reports that it has been reloaded, which it
+// does when it receives SIGHUP, or until ctx is done. Only reloads that happen
+// after WaitForReload is called count, so call it before triggering the
+// reload, e.g. from another goroutine.
+func (l *Connection) WaitForReload(ctx context.Context) error {
+	l.stateMu.Lock()
+	reloaded := l.reloaded
+	l.stateMu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-reloaded:
+		return nil
+	}
+}
+
+// notifyReload wakes up every WaitForReload call.
+func (l *Connection) notifyReload() {
+	// lircd may have been reloaded with different remote controls.
+	l.clearButtonCache()
+
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+
+	close(l.reloaded)
+	l.reloaded = make(chan struct{})
+}
@@ -0,0 +1,31 @@
+package lirc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestWaitForReload(t *testing.T) {
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+
+	waitErr := make(chan error)
+	go func() { waitErr <- conn.WaitForReload(ctx) }()
+
+	select {
+	case err := <-waitErr:
+		t.Fatal("returned before the reload:", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	srv.broadcast("BEGIN", "SIGHUP", "END")
+	assert.NoError(t, <-waitErr, "returns after the reload")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	assert.IsError(t, conn.WaitForReload(ctx), context.DeadlineExceeded, "earlier reloads don't count")
+}
@@ -0,0 +1,136 @@
+package lirc
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+)
+
+// Repeat is a button that lircd is repeatedly sending on behalf of this
+// connection. It is returned by [Connection.RepeatButton].
+type Repeat struct {
+	Remote string
+	Button string
+
+	ctx  context.Context
+	conn *Connection
+	done chan struct{}
+	once sync.Once
+}
+
+// RepeatButton tells lircd to keep sending the given button until the returned
+// Repeat is stopped or the connection is closed. It fails with
+// [ErrNotConnected] if the connection is lost before the repeat is tracked,
+// since lircd stops repeating then.
+func (l *Connection) RepeatButton(ctx context.Context, remote, button string) (*Repeat, error) {
+	l.repeatsMu.Lock()
+	ended := l.repeatsEnded
+	l.repeatsMu.Unlock()
+
+	if _, err := l.SendCommand(ctx, SendStart{remote, button}); err != nil {
+		return nil, err
+	}
+
+	repeat := &Repeat{
+		Remote: remote,
+		Button: button,
+		ctx:    ctx,
+		conn:   l,
+		done:   make(chan struct{}),
+	}
+
+	l.repeatsMu.Lock()
+	// If a session ended meanwhile, it may have been the one that started the
+	// repeat, and its repeats were already ended.
+	lost := l.repeatsEnded != ended
+	if !lost {
+		l.repeats[repeat] = struct{}{}
+	}
+	l.repeatsMu.Unlock()
+
+	if lost {
+		// The command may also have been sent once reconnected, in which case
+		// lircd is repeating the button for the new session.
+		l.SendCommand(ctx, SendStop{remote, button})
+		return nil, ErrNotConnected
+	}
+
+	return repeat, nil
+}
+
+// Stop tells lircd to stop repeating the button. It does nothing if the repeat
+// has already ended. If lircd cannot be told to stop, the repeat stays active
+// and Stop may be called again.
+func (r *Repeat) Stop() error {
+	if !r.Active() {
+		return nil
+	}
+
+	_, err := r.conn.SendCommand(r.ctx, SendStop{r.Remote, r.Button})
+	if err == nil || errors.Is(err, ErrUnsuccessfulCommand) {
+		// lircd either stopped or was no longer repeating the button.
+		r.conn.endRepeat(r)
+	}
+	return err
+}
+
+// Done returns a channel that is closed once the repeat ends, either because
+// it was stopped or because the connection was closed.
+func (r *Repeat) Done() <-chan struct{} {
+	return r.done
+}
+
+// Active returns whether lircd is still repeating the button.
+func (r *Repeat) Active() bool {
+	select {
+	case <-r.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// ActiveRepeat is a button that lircd is repeating for this connection, as
+// returned by [Connection.ActiveRepeats].
+type ActiveRepeat struct {
+	Remote string
+	Button string
+}
+
+// ActiveRepeats returns the buttons that lircd is currently repeating because
+// of [Connection.RepeatButton], sorted by remote control and button name.
+func (l *Connection) ActiveRepeats() []ActiveRepeat {
+	l.repeatsMu.Lock()
+	active := make([]ActiveRepeat, 0, len(l.repeats))
+	for repeat := range l.repeats {
+		active = append(active, ActiveRepeat{repeat.Remote, repeat.Button})
+	}
+	l.repeatsMu.Unlock()
+
+	slices.SortFunc(active, func(a, b ActiveRepeat) int {
+		return cmp.Or(cmp.Compare(a.Remote, b.Remote), cmp.Compare(a.Button, b.Button))
+	})
+	return active
+}
+
+func (l *Connection) endRepeat(repeat *Repeat) {
+	l.repeatsMu.Lock()
+	delete(l.repeats, repeat)
+	l.repeatsMu.Unlock()
+
+	repeat.once.Do(func() { close(repeat.done) })
+}
+
+func (l *Connection) endRepeats() {
+	l.repeatsMu.Lock()
+	repeats := l.repeats
+	l.repeats = make(map[*Repeat]struct{})
+	l.repeatsEnded++
+	l.repeatsMu.Unlock()
+
+	for repeat := range repeats {
+		repeat.once.Do(func() { close(repeat.done) })
+	}
+}
@@ -0,0 +1,84 @@
+package lirc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestRepeatStop(t *testing.T) {
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+
+	repeat, err := conn.RepeatButton(ctx, "remote", "KEY_VOLUMEUP")
+	assert.NoError(t, err, "start repeat")
+	assert.True(t, repeat.Active(), "repeat is active")
+
+	assert.NoError(t, repeat.Stop(), "stop repeat")
+	<-repeat.Done()
+	assert.False(t, repeat.Active(), "repeat is no longer active")
+
+	assert.NoError(t, repeat.Stop(), "stopping twice does nothing")
+	assert.Equal(t, []string{
+		"SEND_START remote KEY_VOLUMEUP",
+		"SEND_STOP remote KEY_VOLUMEUP",
+	}, srv.received())
+}
+
+func TestRepeatConnectionDrop(t *testing.T) {
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+
+	repeat, err := conn.RepeatButton(ctx, "remote", "KEY_VOLUMEUP")
+	assert.NoError(t, err, "start repeat")
+
+	srv.hangup()
+	<-repeat.Done()
+	assert.False(t, repeat.Active(), "repeat ends with the connection")
+}
+
+func TestRepeatSessionEnded(t *testing.T) {
+	var conn *Connection
+	srv := newMockServer(t, func(line string) []string {
+		if strings.HasPrefix(line, "SEND_START") {
+			// The session ends its repeats right after lircd started
+			// repeating, before RepeatButton tracks the new one.
+			conn.endRepeats()
+		}
+		return mockSuccess(line)
+	})
+	conn = newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+
+	_, err := conn.RepeatButton(ctx, "remote", "KEY_VOLUMEUP")
+	assert.IsError(t, err, ErrNotConnected)
+	assert.Zero(t, conn.ActiveRepeats(), "repeat isn't tracked")
+	assert.Equal(t, []string{
+		"SEND_START remote KEY_VOLUMEUP",
+		"SEND_STOP remote KEY_VOLUMEUP",
+	}, srv.received(), "lircd is told to stop, in case it is repeating")
+}
+
+func TestActiveRepeats(t *testing.T) {
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+
+	volume, err := conn.RepeatButton(ctx, "remote", "KEY_VOLUMEUP")
+	assert.NoError(t, err, "start volume repeat")
+	_, err = conn.RepeatButton(ctx, "amp", "KEY_UP")
+	assert.NoError(t, err, "start amp repeat")
+
+	assert.Equal(t, []ActiveRepeat{
+		{"amp", "KEY_UP"},
+		{"remote", "KEY_VOLUMEUP"},
+	}, conn.ActiveRepeats(), "both repeats are active")
+
+	assert.NoError(t, volume.Stop(), "stop volume repeat")
+	assert.Equal(t, []ActiveRepeat{
+		{"amp", "KEY_UP"},
+	}, conn.ActiveRepeats(), "stopped repeat is removed")
+}
@@ -0,0 +1,55 @@
+package lirc
+
+// HandlerPatterns are the remote control and button patterns that a handler is
+// registered for in [RemoteHandlers].
+type HandlerPatterns struct {
+	Remote string
+	Button string
+}
+
+// ReplayedEvent is an event replayed by [ReplayEvents].
+type ReplayedEvent struct {
+	Event ButtonPress
+	// Handlers are the handlers that the event fires, in the order they're
+	// called. It is empty if no handler matches the event.
+	Handlers []HandlerPatterns
+}
+
+// ReplayResult is the outcome of [ReplayEvents].
+type ReplayResult struct {
+	// Events are the replayed events in the order they were given.
+	Events []ReplayedEvent
+}
+
+// Unhandled returns the events that didn't fire any handler.
+func (r ReplayResult) Unhandled() []ButtonPress {
+	var unhandled []ButtonPress
+	for _, e := range r.Events {
+		if len(e.Handlers) == 0 {
+			unhandled = append(unhandled, e.Event)
+		}
+	}
+	return unhandled
+}
+
+// ReplayEvents routes events, such as presses recorded with
+// [Connection.History] or [WithEventTap], to handlers like [RouteEvents] would,
+// and returns which handlers each of them fires. The handlers aren't called, so
+// replaying has no side effects and doesn't need a connection, which makes it
+// suitable for testing a handler map against real presses. opts are applied to
+// the router as usual, such as [WithIgnoreRepeats].
+func ReplayEvents(handlers RemoteHandlers, events []ButtonPress, opts ...RouterOption) ReplayResult {
+	r := NewRouter(handlers, opts...)
+
+	result := ReplayResult{Events: make([]ReplayedEvent, len(events))}
+	for i, event := range events {
+		result.Events[i].Event = event
+		if r.ignoreRepeats && event.RepeatCount > 0 {
+			continue
+		}
+		for _, m := range r.match(event) {
+			result.Events[i].Handlers = append(result.Events[i].Handlers, HandlerPatterns{m.remote, m.button})
+		}
+	}
+	return result
+}
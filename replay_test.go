@@ -0,0 +1,65 @@
+package lirc
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestReplayEvents(t *testing.T) {
+	var called bool
+	handler := func(ButtonPress) { called = true }
+
+	handlers := RemoteHandlers{
+		"tv": ButtonHandlers{
+			"KEY_POWER":   handler,
+			"KEY_VOLUME*": handler,
+		},
+		"*": ButtonHandlers{
+			"KEY_VOLUMEUP": handler,
+		},
+	}
+
+	// Captured with irw(1).
+	var events []ButtonPress
+	for _, line := range []string{
+		"00000000e0e040bf 00 KEY_POWER tv",
+		"00000000e0e0e01f 00 KEY_VOLUMEUP tv",
+		"00000000e0e0e01f 01 KEY_VOLUMEUP tv",
+		"0000000000000490 00 KEY_VOLUMEUP amp",
+		"0000000000000290 00 KEY_MUTE amp",
+	} {
+		event, err := ParseBroadcast(line)
+		assert.NoError(t, err)
+		events = append(events, event)
+	}
+
+	fired := func(result ReplayResult) [][]HandlerPatterns {
+		all := make([][]HandlerPatterns, len(result.Events))
+		for i, e := range result.Events {
+			assert.Equal(t, events[i], e.Event, "event %d", i)
+			all[i] = e.Handlers
+		}
+		return all
+	}
+
+	result := ReplayEvents(handlers, events)
+	assert.Equal(t, [][]HandlerPatterns{
+		{{"tv", "KEY_POWER"}},
+		{{"*", "KEY_VOLUMEUP"}, {"tv", "KEY_VOLUME*"}},
+		{{"*", "KEY_VOLUMEUP"}, {"tv", "KEY_VOLUME*"}},
+		{{"*", "KEY_VOLUMEUP"}},
+		nil,
+	}, fired(result))
+	assert.Equal(t, []ButtonPress{events[4]}, result.Unhandled())
+	assert.False(t, called, "handlers aren't called")
+
+	result = ReplayEvents(handlers, events, WithIgnoreRepeats())
+	assert.Equal(t, [][]HandlerPatterns{
+		{{"tv", "KEY_POWER"}},
+		{{"*", "KEY_VOLUMEUP"}, {"tv", "KEY_VOLUME*"}},
+		nil,
+		{{"*", "KEY_VOLUMEUP"}},
+		nil,
+	}, fired(result))
+}
@@ -0,0 +1,118 @@
+package lirc
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// idempotentCommand is a command marked with Idempotent.
+type idempotentCommand struct {
+	Command
+}
+
+// Idempotent marks command as safe to send again if its reply is lost, so that
+// it is retried as configured by [WithRetries]. [List] and [Version] are always
+// idempotent. Don't mark commands that transmit, such as [SendOnce], since
+// lircd may have sent the button before the reply was lost.
+func Idempotent(command Command) Command {
+	if _, ok := command.(idempotentCommand); ok {
+		return command
+	}
+	return idempotentCommand{command}
+}
+
+// IsIdempotent returns whether command may be sent again if its reply is lost:
+// whether it is a [List] or [Version] command, or was marked with
+// [Idempotent].
+func IsIdempotent(command Command) bool {
+	switch command.(type) {
+	case idempotentCommand, List, Version:
+		return true
+	default:
+		return false
+	}
+}
+
+// unwrapCommand returns the command marked by Idempotent, if any.
+func unwrapCommand(command Command) Command {
+	if c, ok := command.(idempotentCommand); ok {
+		return c.Command
+	}
+	return command
+}
+
+// Retryable is implemented by errors that know whether the command that failed
+// with them may be sent again, such as [CommandError].
+type Retryable interface {
+	error
+	Retryable() bool
+}
+
+// IsTransient returns whether err means that the reply to a command was lost:
+// it was cut short ([ErrReplyLost]), the connection was lost before it arrived
+// ([ErrNotConnected]) or lircd took too long to send it ([ErrReplyTimeout]).
+// lircd may have run the command anyway, so only idempotent commands should
+// be sent again after such errors.
+func IsTransient(err error) bool {
+	return errors.Is(err, ErrReplyLost) ||
+		errors.Is(err, ErrNotConnected) ||
+		errors.Is(err, ErrReplyTimeout)
+}
+
+// IsRetryable returns whether command may succeed if sent again after failing
+// with err: if err is a [Retryable] error that says so, or if command is
+// idempotent (see [IsIdempotent]) and err is transient (see [IsTransient]).
+// Use it to send commands with any retry or backoff library:
+//
+//	for {
+//		reply, err := conn.SendCommand(ctx, command)
+//		if !lirc.IsRetryable(command, err) || ctx.Err() != nil {
+//			return reply, err
+//		}
+//		// Wait for the next attempt.
+//	}
+func IsRetryable(command Command, err error) bool {
+	if err == nil {
+		return false
+	}
+	var r Retryable
+	if errors.As(err, &r) && r.Retryable() {
+		return true
+	}
+	return IsIdempotent(command) && IsTransient(err)
+}
+
+// sendCommandRetry is SendCommand, but idempotent commands are sent again up
+// to opts.retries times if their reply was lost.
+func (l *Connection) sendCommandRetry(ctx context.Context, command Command, enqueue func(context.Context, *pendingCommand) error) (CommandReply, error) {
+	reply, err := l.sendCommandWith(ctx, command, nil, enqueue)
+	if !IsIdempotent(command) {
+		return reply, err
+	}
+
+	for retry := 0; retry < l.opts.retries && ctx.Err() == nil && IsTransient(err); retry++ {
+		reply, err = l.sendCommandWith(ctx, command, nil, enqueue)
+	}
+	return reply, err
+}
+
+// SendUntilSuccess sends the command every interval until it succeeds, ctx is
+// done or it fails with an error that sending it again won't fix, as reported
+// by [IsRetryable]. It returns the last error.
+func (l *Connection) SendUntilSuccess(ctx context.Context, command Command, interval time.Duration) error {
+	for {
+		_, err := l.sendCommand(ctx, command, nil)
+		if ctx.Err() != nil || !IsRetryable(command, err) {
+			return err
+		}
+
+		wait := l.opts.clock.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			wait.Stop()
+			return err
+		case <-wait.C():
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package lirc
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestRetries(t *testing.T) {
+	var dropped atomic.Int32
+	srv := newMockServer(t, func(line string) []string {
+		if (line == "VERSION" || strings.HasPrefix(line, "SEND_ONCE")) && dropped.Add(1) <= 2 {
+			// Lose the reply by starting another packet before its END.
+			return []string{"BEGIN", line, "SUCCESS", "BEGIN", "SIGHUP", "END"}
+		}
+		return mockSuccess(line)
+	})
+	conn := newConnection(srv.dial, []Option{WithRetries(2)})
+	ctx := startTestConnection(t, conn)
+
+	_, err := conn.SendCommand(ctx, Version{})
+	assert.NoError(t, err, "lost replies are retried")
+	assert.Equal(t, []string{"VERSION", "VERSION", "VERSION"}, srv.received())
+
+	dropped.Store(0)
+	_, err = conn.SendCommand(ctx, SendOnce{RemoteControl: "remote", ButtonName: "KEY_POWER"})
+	assert.IsError(t, err, ErrReplyLost, "send commands aren't retried")
+
+	_, err = conn.SendCommand(ctx, Idempotent(SendOnce{RemoteControl: "remote", ButtonName: "KEY_POWER"}))
+	assert.NoError(t, err, "commands marked idempotent are retried")
+	assert.Equal(t, 6, len(srv.received()), "commands sent")
+}
+
+func TestSendUntilSuccess(t *testing.T) {
+	const interval = time.Second
+
+	var attempts atomic.Int32
+	srv := newMockServer(t, func(line string) []string {
+		if attempts.Add(1) <= 2 {
+			return mockReply(line, false, "busy: repeating")
+		}
+		return mockSuccess(line)
+	})
+	clock := newFakeClock()
+	conn := newConnection(srv.dial, []Option{withClock(clock)})
+	ctx := startTestConnection(t, conn)
+
+	done := make(chan error)
+	go func() {
+		done <- conn.SendUntilSuccess(ctx, SendOnce{RemoteControl: "remote", ButtonName: "KEY_POWER"}, interval)
+	}()
+
+	for attempt := int32(1); attempt <= 2; attempt++ {
+		eventually(t, func() bool { return attempts.Load() == attempt && clock.HasTimer(interval) }, "retry wait")
+		clock.Advance(interval)
+	}
+	assert.NoError(t, <-done, "third attempt succeeds")
+	assert.Equal(t, int32(3), attempts.Load(), "attempts")
+}
+
+func TestSendUntilSuccessPermanent(t *testing.T) {
+	srv := newMockServer(t, func(line string) []string {
+		return mockReply(line, false, `unknown remote: "missing"`)
+	})
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+
+	err := conn.SendUntilSuccess(ctx, SendOnce{RemoteControl: "missing", ButtonName: "KEY_POWER"}, time.Second)
+	assert.IsError(t, err, ErrUnknownRemote, "permanent errors aren't retried")
+	assert.Equal(t, 1, len(srv.received()), "sent once")
+}
+
+func TestIsRetryable(t *testing.T) {
+	send := SendOnce{RemoteControl: "remote", ButtonName: "KEY_POWER"}
+	busy := &CommandError{Command: "SEND_ONCE", Message: "busy: repeating"}
+	unknown := &CommandError{Command: "SEND_ONCE", Message: `unknown remote: "remote"`}
+
+	assert.True(t, IsRetryable(send, busy), "busy lircd didn't transmit")
+	assert.False(t, IsRetryable(send, unknown), "unknown remote is permanent")
+	assert.False(t, IsRetryable(send, ErrReplyLost), "lost reply to a transmission")
+	assert.True(t, IsRetryable(Version{}, ErrReplyLost), "lost reply to an idempotent command")
+	assert.True(t, IsRetryable(Idempotent(send), ErrReplyTimeout), "lost reply to a command marked idempotent")
+	assert.False(t, IsRetryable(Version{}, nil), "no error")
+}
+
+func TestHandRolledRetry(t *testing.T) {
+	var attempts atomic.Int32
+	srv := newMockServer(t, func(line string) []string {
+		if attempts.Add(1) <= 2 {
+			return []string{"BEGIN", line, "SUCCESS", "BEGIN", "SIGHUP", "END"}
+		}
+		return mockSuccess(line)
+	})
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+
+	send := func(command Command) (reply CommandReply, err error) {
+		for attempt := 0; attempt < 5; attempt++ {
+			reply, err = conn.SendCommand(ctx, command)
+			if !IsRetryable(command, err) || ctx.Err() != nil {
+				break
+			}
+		}
+		return reply, err
+	}
+
+	_, err := send(Version{})
+	assert.NoError(t, err, "retried until the reply arrives")
+	assert.Equal(t, int32(3), attempts.Load(), "attempts")
+}
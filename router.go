@@ -1,45 +1,472 @@
 package lirc
 
 import (
+	"cmp"
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type RemoteHandlers map[string]ButtonHandlers
 type ButtonHandlers map[string]ButtonHandler
 type ButtonHandler func(ButtonPress)
 
+// ButtonHandlerCtx is like ButtonHandler, but it is also given the context
+// that events are routed with, which is canceled once routing stops. See
+// [Router.OnCtx].
+type ButtonHandlerCtx func(context.Context, ButtonPress)
+
+// WithContext adapts h to a ButtonHandlerCtx that ignores its context.
+func (h ButtonHandler) WithContext() ButtonHandlerCtx {
+	if h == nil {
+		return nil
+	}
+	return func(_ context.Context, p ButtonPress) { h(p) }
+}
+
+// CodeHandlers maps button codes to handlers. See [Router.OnCode].
+type CodeHandlers map[uint64]ButtonHandler
+
+// Errors returned by [Router.OnUnique].
+var (
+	// ErrDuplicateHandler is returned when a handler is already registered for
+	// the exact same remote control and button patterns.
+	ErrDuplicateHandler = errors.New("lirc: duplicate handler")
+	// ErrOverlappingHandler is returned when a handler is already registered
+	// for patterns that overlap with the new ones.
+	ErrOverlappingHandler = errors.New("lirc: overlapping handler")
+)
+
 // RouteEvents routes events to the appropriate handler until ctx is canceled.
 // Both the remote control name and button name can be matched with patterns
 // using filepath.Match. For example, "*" will match any string.
-func RouteEvents(ctx context.Context, events <-chan ButtonPress, handlers RemoteHandlers) error {
+func RouteEvents(ctx context.Context, events <-chan ButtonPress, handlers RemoteHandlers, opts ...RouterOption) error {
+	return NewRouter(handlers, opts...).Run(ctx, events)
+}
+
+// StartRouter routes events to handlers like [RouteEvents] in a new goroutine
+// until stop is called. stop doesn't wait for the handler being called, if
+// any, to return; done is closed once routing has stopped. stop may be called
+// more than once.
+func StartRouter(events <-chan ButtonPress, handlers RemoteHandlers, opts ...RouterOption) (stop func(), done <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		RouteEvents(ctx, events, handlers, opts...)
+	}()
+	return cancel, stopped
+}
+
+// Run starts conn and routes its events to handlers like [RouteEvents] until
+// ctx is done or the connection fails, whichever comes first. It returns once
+// both are stopped, with the error that stopped them. Logs are written to
+// [slog.Default]. Use [os/signal.NotifyContext] to stop on a signal.
+//
+// conn must not have been created with [WithConnEvents].
+func Run(ctx context.Context, conn *Connection, handlers RemoteHandlers, opts ...RouterOption) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		cancel(conn.Start(ctx, slog.Default()))
+	}()
+
+	RouteEvents(ctx, conn.Events, handlers, opts...)
+	wg.Wait()
+
+	return context.Cause(ctx)
+}
+
+// Router routes events to handlers registered by remote control and button
+// name. Both names can be patterns as described in [RouteEvents]. A handler
+// registered for the exact remote control and button name of an event takes
+// precedence; otherwise, every handler whose patterns match is called, the
+// most specific patterns (those with the most non-wildcard characters) first.
+//
+// Handlers may also be registered by button code using [Router.OnCode]. They
+// are only called for events that no handler matched by name.
+//
+// Handlers may be registered while the router is running.
+type Router struct {
+	mu       sync.RWMutex
+	handlers map[string]map[string]ButtonHandlerCtx
+	codes    map[string]map[uint64]ButtonHandlerCtx
+	// onces holds the flag of each handler registered with Once by its
+	// patterns, which tells whether it is still the registered one.
+	onces map[[2]string]*atomic.Bool
+
+	ignoreRepeats bool
+	clock         clock
+}
+
+// RouterOption configures a [Router].
+type RouterOption func(*Router)
+
+// WithIgnoreRepeats makes the router drop every event with a non-zero repeat
+// count, so that handlers are called once per press no matter how long the
+// button is held.
+func WithIgnoreRepeats() RouterOption {
+	return func(r *Router) {
+		r.ignoreRepeats = true
+	}
+}
+
+// withRouterClock sets the clock used by the router. It is used by tests.
+func withRouterClock(c clock) RouterOption {
+	return func(r *Router) {
+		r.clock = c
+	}
+}
+
+// NewRouter creates a new Router with the given handlers, which may be nil.
+func NewRouter(handlers RemoteHandlers, opts ...RouterOption) *Router {
+	r := &Router{
+		handlers: newHandlerMap(handlers),
+		codes:    make(map[string]map[uint64]ButtonHandlerCtx),
+		onces:    make(map[[2]string]*atomic.Bool),
+		clock:    realClock{},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Replace replaces every registered handler with the given ones, including
+// the handlers registered by code with [Router.OnCode]. Events being
+// dispatched while Replace is called are handled by either the old or the new
+// handlers, never a mix of both.
+func (r *Router) Replace(handlers RemoteHandlers) {
+	m := newHandlerMap(handlers)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.handlers = m
+	r.codes = make(map[string]map[uint64]ButtonHandlerCtx)
+	r.onces = make(map[[2]string]*atomic.Bool)
+}
+
+func newHandlerMap(handlers RemoteHandlers) map[string]map[string]ButtonHandlerCtx {
+	m := make(map[string]map[string]ButtonHandlerCtx, len(handlers))
+	for remote, buttonHandlers := range handlers {
+		m[remote] = make(map[string]ButtonHandlerCtx, len(buttonHandlers))
+		for button, h := range buttonHandlers {
+			m[remote][button] = h.WithContext()
+		}
+	}
+	return m
+}
+
+// On registers h for the given remote control and button patterns, replacing
+// any handler registered for the same patterns.
+func (r *Router) On(remote, button string, h ButtonHandler) {
+	r.OnCtx(remote, button, h.WithContext())
+}
+
+// OnCtx is like On, but h is also given the context that events are routed
+// with by [Router.Run] or [Router.DispatchCtx].
+func (r *Router) OnCtx(remote, button string, h ButtonHandlerCtx) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.on(remote, button, h)
+}
+
+// OnEach registers h for every combination of the given remote control and
+// button patterns, as if On was called for each of them.
+func (r *Router) OnEach(remotes, buttons []string, h ButtonHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, remote := range remotes {
+		for _, button := range buttons {
+			r.on(remote, button, h.WithContext())
+		}
+	}
+}
+
+// OnCode registers h for buttons with the given code on remote controls
+// matching the remote pattern. This is useful for buttons that don't have a
+// (meaningful) name. Code handlers are only called if no handler matched the
+// event by name.
+func (r *Router) OnCode(remote string, code uint64, h ButtonHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.codes[remote] == nil {
+		r.codes[remote] = make(map[uint64]ButtonHandlerCtx)
+	}
+	r.codes[remote][code] = h.WithContext()
+}
+
+// OnNumeric registers h for buttons on remote controls matching the remote
+// pattern whose name is prefix followed by a signed decimal number, such as
+// KEY_NUMERIC_3 for the prefix "KEY_NUMERIC_" or JOG_-1 for "JOG_". h is called
+// with that number as delta, which is useful for rotary encoders and jog dials
+// whose events are accumulated. Buttons with the prefix but no number are
+// ignored. The prefix is matched literally, even if it contains characters
+// that are special in patterns.
+func (r *Router) OnNumeric(remote, prefix string, h func(p ButtonPress, delta int)) {
+	r.On(remote, escapePattern(prefix)+"*", func(p ButtonPress) {
+		delta, err := strconv.Atoi(strings.TrimPrefix(p.ButtonName, prefix))
+		if err != nil {
+			return
+		}
+		h(p, delta)
+	})
+}
+
+// heldGap is how long after the last event of a held button OnHeld considers
+// it released. lircd repeats held buttons about every 100ms.
+const heldGap = 500 * time.Millisecond
+
+// OnHeld registers h for the given remote control and button patterns like On,
+// but h is also given how long the button has been held, which is useful to
+// accelerate e.g. volume changes. A hold begins with the first press, or once
+// no event was received for the button for a short while. Durations are
+// measured with the monotonic clock, so changes to the system time don't
+// affect them.
+func (r *Router) OnHeld(remote, button string, h func(p ButtonPress, heldFor time.Duration)) {
+	type hold struct{ start, last time.Time }
+
+	var mu sync.Mutex
+	holds := make(map[[2]string]hold)
+
+	r.On(remote, button, func(p ButtonPress) {
+		now := r.clock.Now()
+		key := [2]string{p.RemoteControlName, p.ButtonName}
+
+		mu.Lock()
+		held, ok := holds[key]
+		if !ok || p.RepeatCount == 0 || now.Sub(held.last) > heldGap {
+			held.start = now
+		}
+		held.last = now
+		holds[key] = held
+		mu.Unlock()
+
+		h(p, now.Sub(held.start))
+	})
+}
+
+// OnUnique is like On, but it returns an error instead of registering h if it
+// collides with an existing handler: [ErrDuplicateHandler] if one is
+// registered for the exact same patterns, or [ErrOverlappingHandler] if one
+// is registered for patterns such that one of them matches the other.
+func (r *Router) OnUnique(remote, button string, h ButtonHandler) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for existingRemote, buttonHandlers := range r.handlers {
+		for existingButton := range buttonHandlers {
+			if existingRemote == remote && existingButton == button {
+				return fmt.Errorf("%w for remote %q button %q", ErrDuplicateHandler, remote, button)
+			}
+			if patternsOverlap(existingRemote, remote) && patternsOverlap(existingButton, button) {
+				return fmt.Errorf(
+					"%w: remote %q button %q overlaps with remote %q button %q",
+					ErrOverlappingHandler, remote, button, existingRemote, existingButton)
+			}
+		}
+	}
+
+	r.on(remote, button, h.WithContext())
+	return nil
+}
+
+// Once is like On, but h is only called for the first matching event, after
+// which it is unregistered. Use it for one-off prompts such as setup wizards.
+// A handler registered for the same patterns before h fires replaces it and
+// stays registered.
+func (r *Router) Once(remote, button string, h ButtonHandler) {
+	fired := new(atomic.Bool)
+	key := [2]string{remote, button}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.on(remote, button, func(_ context.Context, p ButtonPress) {
+		// Events may be dispatched concurrently, so only the first one wins.
+		if !fired.CompareAndSwap(false, true) {
+			return
+		}
+
+		// Only unregister h if it wasn't replaced in the meantime.
+		r.mu.Lock()
+		if r.onces[key] == fired {
+			r.off(remote, button)
+		}
+		r.mu.Unlock()
+
+		h(p)
+	})
+	r.onces[key] = fired
+}
+
+func (r *Router) on(remote, button string, h ButtonHandlerCtx) {
+	if r.handlers[remote] == nil {
+		r.handlers[remote] = make(map[string]ButtonHandlerCtx)
+	}
+	r.handlers[remote][button] = h
+	delete(r.onces, [2]string{remote, button})
+}
+
+func (r *Router) off(remote, button string) {
+	delete(r.onces, [2]string{remote, button})
+	delete(r.handlers[remote], button)
+	if len(r.handlers[remote]) == 0 {
+		delete(r.handlers, remote)
+	}
+}
+
+// escapePattern escapes the characters of s that are special in patterns, so
+// that the pattern only matches s itself.
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if isPatternMeta(r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func isPatternMeta(r rune) bool {
+	return strings.ContainsRune(`*?[]\`, r)
+}
+
+// patternsOverlap returns whether either pattern matches the other.
+func patternsOverlap(a, b string) bool {
+	aMatched, _ := filepath.Match(a, b)
+	bMatched, _ := filepath.Match(b, a)
+	return aMatched || bMatched
+}
+
+// Run routes events to the registered handlers until ctx is canceled. Handlers
+// registered with [Router.OnCtx] are given ctx.
+func (r *Router) Run(ctx context.Context, events <-chan ButtonPress) error {
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 
 		case event := <-events:
-			// Check for exact match
-			if h := handlers[event.RemoteControlName][event.ButtonName]; h != nil {
-				h(event)
+			r.DispatchCtx(ctx, event)
+		}
+	}
+}
+
+// Dispatch calls the handlers matching the given event.
+func (r *Router) Dispatch(event ButtonPress) {
+	r.DispatchCtx(context.Background(), event)
+}
+
+// DispatchCtx is like Dispatch, but handlers registered with [Router.OnCtx] are
+// given ctx.
+func (r *Router) DispatchCtx(ctx context.Context, event ButtonPress) {
+	if r.ignoreRepeats && event.RepeatCount > 0 {
+		return
+	}
+
+	for _, m := range r.match(event) {
+		m.h(ctx, event)
+	}
+}
+
+// match returns the handlers matching event in the order they're called.
+func (r *Router) match(event ButtonPress) []patternMatch {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// Check for exact match
+	if h := r.handlers[event.RemoteControlName][event.ButtonName]; h != nil {
+		return []patternMatch{{event.RemoteControlName, event.ButtonName, h}}
+	}
+
+	// Check for pattern matches
+	var matches []patternMatch
+	for remote, buttonHandlers := range r.handlers {
+		remoteMatched, _ := filepath.Match(remote, event.RemoteControlName)
+		if !remoteMatched {
+			continue
+		}
+
+		for button, h := range buttonHandlers {
+			buttonMatched, _ := filepath.Match(button, event.ButtonName)
+			if !buttonMatched {
+				continue
+			}
+			matches = append(matches, patternMatch{remote, button, h})
+		}
+	}
+
+	// Fall back to matching by code
+	if len(matches) == 0 {
+		for remote, codeHandlers := range r.codes {
+			remoteMatched, _ := filepath.Match(remote, event.RemoteControlName)
+			if !remoteMatched {
 				continue
 			}
 
-			// Check for pattern matches
-			for remote, buttonHandlers := range handlers {
-				remoteMatched, _ := filepath.Match(remote, event.RemoteControlName)
-				if !remoteMatched {
-					continue
-				}
-
-				for button, h := range buttonHandlers {
-					buttonMatched, _ := filepath.Match(button, event.ButtonName)
-					if !buttonMatched {
-						continue
-					}
-					h(event)
-				}
+			if h := codeHandlers[event.Code]; h != nil {
+				matches = append(matches, patternMatch{remote: remote, h: h})
 			}
 		}
 	}
+
+	// Map order is random, so sort the handlers to call them in a stable
+	// order: the most specific patterns first, then by pattern.
+	slices.SortFunc(matches, func(a, b patternMatch) int {
+		return cmp.Or(
+			cmp.Compare(b.specificity(), a.specificity()),
+			cmp.Compare(a.remote, b.remote),
+			cmp.Compare(a.button, b.button))
+	})
+
+	return matches
+}
+
+// patternMatch is a handler whose patterns matched an event. button is empty
+// for handlers registered by code.
+type patternMatch struct {
+	remote string
+	button string
+	h      ButtonHandlerCtx
+}
+
+// specificity returns the number of characters in the patterns that aren't
+// wildcards, counting escaped characters. Patterns with more of them match
+// fewer names.
+func (m patternMatch) specificity() int {
+	return literalLen(m.remote) + literalLen(m.button)
+}
+
+func literalLen(pattern string) int {
+	n := 0
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+			n++
+		case r == '\\':
+			escaped = true
+		case !isPatternMeta(r):
+			n++
+		}
+	}
+	return n
 }
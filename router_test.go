@@ -0,0 +1,320 @@
+package lirc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestRouterOnUnique(t *testing.T) {
+	noop := func(ButtonPress) {}
+
+	r := NewRouter(RemoteHandlers{
+		"tv": ButtonHandlers{"KEY_POWER": noop},
+	})
+
+	assert.IsError(t, r.OnUnique("tv", "KEY_POWER", noop), ErrDuplicateHandler, "exact duplicate")
+	assert.IsError(t, r.OnUnique("tv", "KEY_*", noop), ErrOverlappingHandler, "wildcard button overlaps")
+	assert.IsError(t, r.OnUnique("*", "KEY_POWER", noop), ErrOverlappingHandler, "wildcard remote overlaps")
+
+	assert.NoError(t, r.OnUnique("tv", "KEY_MUTE", noop), "different button")
+	assert.NoError(t, r.OnUnique("amp", "KEY_*", noop), "different remote")
+	assert.IsError(t, r.OnUnique("amp", "KEY_VOLUMEUP", noop), ErrOverlappingHandler, "overlaps existing wildcard")
+}
+
+func TestRouterDispatch(t *testing.T) {
+	var fired []string
+	handler := func(name string) ButtonHandler {
+		return func(ButtonPress) { fired = append(fired, name) }
+	}
+
+	r := NewRouter(nil)
+	r.On("tv", "KEY_POWER", handler("exact"))
+	r.On("tv", "KEY_VOLUME*", handler("volume"))
+
+	r.Dispatch(ButtonPress{RemoteControlName: "tv", ButtonName: "KEY_POWER"})
+	r.Dispatch(ButtonPress{RemoteControlName: "tv", ButtonName: "KEY_VOLUMEUP"})
+	r.Dispatch(ButtonPress{RemoteControlName: "amp", ButtonName: "KEY_POWER"})
+
+	assert.Equal(t, []string{"exact", "volume"}, fired)
+}
+
+func TestRouteEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	events := make(chan ButtonPress)
+	pressed := make(chan ButtonPress)
+
+	done := make(chan error)
+	go func() {
+		done <- RouteEvents(ctx, events, RemoteHandlers{
+			"*": ButtonHandlers{"*": func(p ButtonPress) { pressed <- p }},
+		})
+	}()
+
+	events <- ButtonPress{RemoteControlName: "tv", ButtonName: "KEY_POWER"}
+	assert.Equal(t, "KEY_POWER", (<-pressed).ButtonName, "event is routed")
+
+	cancel()
+	assert.IsError(t, <-done, context.Canceled, "routing stops with ctx")
+}
+
+func TestStartRouter(t *testing.T) {
+	events := make(chan ButtonPress)
+	pressed := make(chan ButtonPress, 1)
+
+	stop, done := StartRouter(events, RemoteHandlers{
+		"*": ButtonHandlers{"*": func(p ButtonPress) { pressed <- p }},
+	})
+
+	events <- ButtonPress{RemoteControlName: "tv", ButtonName: "KEY_POWER"}
+	assert.Equal(t, "KEY_POWER", (<-pressed).ButtonName, "event is routed")
+
+	stop()
+	<-done
+	stop()
+
+	select {
+	case events <- ButtonPress{RemoteControlName: "tv", ButtonName: "KEY_MUTE"}:
+		t.Fatal("event routed after stop")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRouterOnCode(t *testing.T) {
+	var fired []string
+	handler := func(name string) ButtonHandler {
+		return func(ButtonPress) { fired = append(fired, name) }
+	}
+
+	r := NewRouter(nil)
+	r.On("tv", "KEY_POWER", handler("name"))
+	r.OnCode("tv", 0x40bf, handler("power code"))
+	r.OnCode("*", 0xe01f, handler("volume code"))
+
+	r.Dispatch(ButtonPress{RemoteControlName: "tv", Code: 0x40bf, ButtonName: "KEY_POWER"})
+	r.Dispatch(ButtonPress{RemoteControlName: "tv", Code: 0x40bf, ButtonName: ""})
+	r.Dispatch(ButtonPress{RemoteControlName: "amp", Code: 0xe01f, ButtonName: "UNKNOWN"})
+	r.Dispatch(ButtonPress{RemoteControlName: "amp", Code: 0x1234, ButtonName: "UNKNOWN"})
+
+	assert.Equal(t, []string{"name", "power code", "volume code"}, fired,
+		"names take precedence over codes")
+}
+
+func TestRouterOnEach(t *testing.T) {
+	var fired []string
+	r := NewRouter(nil)
+	r.OnEach([]string{"tv", "amp"}, []string{"KEY_UP", "KEY_DOWN"}, func(p ButtonPress) {
+		fired = append(fired, p.RemoteControlName+" "+p.ButtonName)
+	})
+
+	r.Dispatch(ButtonPress{RemoteControlName: "tv", ButtonName: "KEY_UP"})
+	r.Dispatch(ButtonPress{RemoteControlName: "amp", ButtonName: "KEY_DOWN"})
+	r.Dispatch(ButtonPress{RemoteControlName: "tv", ButtonName: "KEY_LEFT"})
+
+	assert.Equal(t, []string{"tv KEY_UP", "amp KEY_DOWN"}, fired, "listed buttons share the handler")
+}
+
+func TestRouterOnNumeric(t *testing.T) {
+	var total int
+	r := NewRouter(nil)
+	r.OnNumeric("dial", "JOG_", func(_ ButtonPress, delta int) { total += delta })
+
+	for _, button := range []string{"JOG_1", "JOG_2", "JOG_-1", "JOG_+3", "JOG_PUSH", "JOG_"} {
+		r.Dispatch(ButtonPress{RemoteControlName: "dial", ButtonName: button})
+	}
+	assert.Equal(t, 5, total, "numeric deltas are accumulated")
+}
+
+func TestRouterOnNumericLiteralPrefix(t *testing.T) {
+	var total int
+	r := NewRouter(nil)
+	r.OnNumeric("dial", "JOG*[", func(_ ButtonPress, delta int) { total += delta })
+
+	for _, button := range []string{"JOG*[1", "JOG*[2", "JOG_3", "JOGX[4", "JOG*X5"} {
+		r.Dispatch(ButtonPress{RemoteControlName: "dial", ButtonName: button})
+	}
+	assert.Equal(t, 3, total, "only buttons with the literal prefix match")
+}
+
+func TestRouterOnce(t *testing.T) {
+	var once, always int
+	r := NewRouter(nil)
+	r.Once("tv", "KEY_OK", func(ButtonPress) { once++ })
+	r.On("*", "*", func(ButtonPress) { always++ })
+
+	for range 3 {
+		r.Dispatch(ButtonPress{RemoteControlName: "tv", ButtonName: "KEY_OK"})
+	}
+	assert.Equal(t, 1, once, "once handler fires a single time")
+	assert.Equal(t, 2, always, "other handlers match once it is removed")
+}
+
+func TestRouterOnceReplaced(t *testing.T) {
+	var once, replaced int
+	r := NewRouter(nil)
+	r.Once("*", "KEY_OK", func(ButtonPress) { once++ })
+	// This handler is more specific, so it is called first and replaces the
+	// once handler after it was matched but before it fires.
+	r.On("tv", "KEY_O*", func(ButtonPress) {
+		r.On("*", "KEY_OK", func(ButtonPress) { replaced++ })
+	})
+
+	for range 3 {
+		r.Dispatch(ButtonPress{RemoteControlName: "tv", ButtonName: "KEY_OK"})
+	}
+	assert.Equal(t, 1, once, "once handler fires a single time")
+	assert.Equal(t, 2, replaced, "the replacing handler stays registered")
+}
+
+func TestRouterReplace(t *testing.T) {
+	var old, replaced atomic.Int64
+	r := NewRouter(RemoteHandlers{
+		"tv": {"KEY_OK": func(ButtonPress) { old.Add(1) }},
+	})
+	r.OnCode("tv", 0x1, func(ButtonPress) { old.Add(1) })
+
+	next := RemoteHandlers{
+		"tv": {"KEY_OK": func(ButtonPress) { replaced.Add(1) }},
+	}
+
+	const dispatches = 1000
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range dispatches {
+			r.Dispatch(ButtonPress{RemoteControlName: "tv", ButtonName: "KEY_OK", Code: 0x1})
+		}
+	}()
+	for range 100 {
+		r.Replace(next)
+	}
+	<-done
+
+	assert.Equal(t, int64(dispatches), old.Load()+replaced.Load(),
+		"each dispatch calls exactly one handler")
+
+	r.Dispatch(ButtonPress{RemoteControlName: "tv", ButtonName: "KEY_MUTE", Code: 0x1})
+	assert.Equal(t, int64(dispatches), old.Load()+replaced.Load(), "code handlers are replaced too")
+}
+
+func TestRouterOnHeld(t *testing.T) {
+	clock := newFakeClock()
+	r := NewRouter(nil, withRouterClock(clock))
+
+	var held []time.Duration
+	r.OnHeld("tv", "KEY_VOLUMEUP", func(_ ButtonPress, heldFor time.Duration) {
+		held = append(held, heldFor)
+	})
+
+	press := func(repeat uint) {
+		r.Dispatch(ButtonPress{RemoteControlName: "tv", ButtonName: "KEY_VOLUMEUP", RepeatCount: repeat})
+	}
+
+	press(0)
+	clock.Advance(100 * time.Millisecond)
+	press(1)
+	clock.Advance(100 * time.Millisecond)
+	press(2)
+	clock.Advance(time.Second)
+	press(3) // repeat whose release was missed
+	clock.Advance(100 * time.Millisecond)
+	press(0)
+
+	assert.Equal(t, []time.Duration{
+		0,
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		0,
+		0,
+	}, held, "hold duration increases and resets after a gap")
+}
+
+func TestRun(t *testing.T) {
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pressed := make(chan ButtonPress)
+	done := make(chan error)
+	go func() {
+		done <- Run(ctx, conn, RemoteHandlers{
+			"remote": ButtonHandlers{"KEY_POWER": func(p ButtonPress) { pressed <- p }},
+		})
+	}()
+
+	srv.broadcast("00000000e0e040bf 00 KEY_POWER remote")
+	assert.Equal(t, "KEY_POWER", (<-pressed).ButtonName, "event is routed")
+
+	cancel()
+	assert.IsError(t, <-done, context.Canceled, "returns when ctx is done")
+	assert.False(t, conn.Connected(), "connection is stopped")
+}
+
+func TestRunConnectionFails(t *testing.T) {
+	dialErr := errors.New("no lircd here")
+	conn := newConnection(func(context.Context) (net.Conn, error) { return nil, dialErr }, nil)
+
+	err := Run(context.Background(), conn, nil)
+	assert.IsError(t, err, dialErr, "returns when the connection fails")
+}
+
+func TestRouterIgnoreRepeats(t *testing.T) {
+	var fired int
+	r := NewRouter(RemoteHandlers{
+		"tv": ButtonHandlers{"KEY_VOLUMEUP": func(ButtonPress) { fired++ }},
+	}, WithIgnoreRepeats())
+
+	for i := range 5 {
+		r.Dispatch(ButtonPress{RemoteControlName: "tv", ButtonName: "KEY_VOLUMEUP", RepeatCount: uint(i)})
+	}
+	assert.Equal(t, 1, fired, "handler fires once per press")
+}
+
+func TestRouterDispatchOrder(t *testing.T) {
+	var fired []string
+	handler := func(name string) ButtonHandler {
+		return func(ButtonPress) { fired = append(fired, name) }
+	}
+
+	r := NewRouter(nil)
+	r.On("*", "*", handler("*/*"))
+	r.On("*", "KEY_VOLUME*", handler("*/KEY_VOLUME*"))
+	r.On("tv", "KEY_*", handler("tv/KEY_*"))
+	r.On("t?", "KEY_*", handler("t?/KEY_*"))
+	r.On("*", "KEY_*", handler("*/KEY_*"))
+
+	for range 10 {
+		fired = nil
+		r.Dispatch(ButtonPress{RemoteControlName: "tv", ButtonName: "KEY_VOLUMEUP"})
+		assert.Equal(t, []string{"*/KEY_VOLUME*", "tv/KEY_*", "t?/KEY_*", "*/KEY_*", "*/*"}, fired,
+			"most specific patterns first")
+	}
+}
+
+func TestRouterOnCtx(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	handlerCtx := make(chan context.Context)
+	r := NewRouter(nil)
+	r.OnCtx("tv", "KEY_POWER", func(ctx context.Context, _ ButtonPress) { handlerCtx <- ctx })
+
+	events := make(chan ButtonPress)
+	done := make(chan error)
+	go func() { done <- r.Run(ctx, events) }()
+
+	events <- ButtonPress{RemoteControlName: "tv", ButtonName: "KEY_POWER"}
+	got := <-handlerCtx
+	assert.NoError(t, got.Err(), "context is live while routing")
+
+	cancel()
+	<-done
+	assert.IsError(t, got.Err(), context.Canceled, "context is canceled once routing stops")
+}
@@ -0,0 +1,203 @@
+package lirc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ErrBusy is returned by [Connection.TrySendCommand] when the command can't be
+// sent right away.
+var ErrBusy = errors.New("lirc: connection busy")
+
+// TrySendCommand is like [Connection.SendCommand], but it fails with [ErrBusy]
+// instead of waiting if another command is waiting for its reply or being
+// sent, and with [ErrNotConnected] if the connection isn't established. It
+// never starts the connection, even with [WithAutoStart]. Once sent, the
+// command waits for its reply as usual, until the connection stops. Use it in
+// event handlers that would rather skip a command than hold up the events that
+// follow.
+func (l *Connection) TrySendCommand(command Command) (CommandReply, error) {
+	if !l.opts.receiveOnly && !l.Connected() {
+		return CommandReply{}, ErrNotConnected
+	}
+	return l.sendCommandWith(l.Context(), command, nil, l.tryEnqueue)
+}
+
+// tryEnqueue is enqueue, but it fails with ErrBusy instead of waiting.
+func (l *Connection) tryEnqueue(_ context.Context, pending *pendingCommand) error {
+	if !l.seqMu.TryLock() {
+		return ErrBusy
+	}
+	defer l.seqMu.Unlock()
+
+	inflight := l.sessionInflight.Load()
+	if inflight == nil {
+		return ErrNotConnected
+	}
+	if !inflight.empty() || l.writing.Load() {
+		return ErrBusy
+	}
+
+	// The sender goroutine is free, so it takes the command as soon as it's
+	// back to waiting for one. Holding seqMu keeps other callers from taking
+	// its place in the meantime.
+	select {
+	case <-l.sendingStopped():
+		return ErrNotConnected
+	case l.send <- pending:
+		return nil
+	}
+}
+
+// SendOnceBlocking sends the button like [SendOnce] and then waits for about as
+// long as transmitting it takes, so that the next command doesn't clobber the
+// transmission. lircd replies as soon as it starts transmitting and never
+// reports when it's done, so the wait is only an estimate: the button is
+// assumed to be sent repeats+1 times, each frame taking estimatedFrameDuration.
+func (l *Connection) SendOnceBlocking(ctx context.Context, remote, button string, repeats uint, estimatedFrameDuration time.Duration) error {
+	_, err := l.SendCommand(ctx, SendOnce{
+		RemoteControl: remote,
+		ButtonName:    button,
+		Repeats:       repeats,
+	})
+	if err != nil {
+		return err
+	}
+
+	wait := l.opts.clock.NewTimer(time.Duration(repeats+1) * estimatedFrameDuration)
+	defer wait.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-wait.C():
+		return nil
+	}
+}
+
+// SendMany sends each button of the remote control like [SendOnce], in order
+// and without any delay between them, such as the digits of a channel number.
+// It stops at the first button that fails to be sent. ctx applies to all of
+// them.
+func (l *Connection) SendMany(ctx context.Context, remote string, buttons ...string) error {
+	for _, button := range buttons {
+		_, err := l.SendCommand(ctx, SendOnce{RemoteControl: remote, ButtonName: button})
+		if err != nil {
+			return fmt.Errorf("cannot send %s: %w", button, err)
+		}
+	}
+	return nil
+}
+
+// SendOnceVia sends the button like [SendOnce], but only on the given
+// transmitters, which are numbered from 1. It sets the transmitters with
+// [SetTransmitters], sends the button and then restores the transmitters that
+// were last set through this connection, if any. lircd has no way to query its
+// current transmitters, so they are left as given if they were never set
+// through this connection. No other command is sent on the connection in the
+// meantime.
+func (l *Connection) SendOnceVia(ctx context.Context, remote, button string, channels ...uint) error {
+	mask, err := transmitterMask(channels)
+	if err != nil {
+		return err
+	}
+
+	// Start the connection before taking seqMu, like enqueueNext.
+	if l.opts.autoStart != nil {
+		if err := l.autoStart(ctx); err != nil {
+			return err
+		}
+	}
+
+	l.seqMu.Lock()
+	defer l.seqMu.Unlock()
+
+	previous := l.lastTransmitters()
+
+	if _, err := l.sendCommandWith(ctx, SetTransmitters{TransmitterMask: mask}, nil, l.enqueue); err != nil {
+		return fmt.Errorf("cannot set transmitters: %w", err)
+	}
+
+	_, sendErr := l.sendCommandWith(ctx, SendOnce{RemoteControl: remote, ButtonName: button}, nil, l.enqueue)
+
+	if previous != "" && previous != mask {
+		if _, err := l.sendCommandWith(ctx, SetTransmitters{TransmitterMask: previous}, nil, l.enqueue); err != nil {
+			return errors.Join(sendErr, fmt.Errorf("cannot restore transmitters: %w", err))
+		}
+	}
+
+	return sendErr
+}
+
+// WithLock calls fn with a [Sender] that sends commands on the connection while
+// no other command can be, so that the commands fn sends, such as buttons of
+// several remote controls, are transmitted in a row without being interleaved
+// with the commands of other goroutines. They wait for fn to return. fn must
+// only send commands with s, and not use s after returning: sending with the
+// connection itself would wait for fn forever. With [WithAutoStart], the
+// connection is started first, which fails if ctx is done before it is
+// established. WithLock returns the error returned by fn.
+func (l *Connection) WithLock(ctx context.Context, fn func(s Sender) error) error {
+	// Start the connection before taking seqMu, like enqueueNext.
+	if l.opts.autoStart != nil {
+		if err := l.autoStart(ctx); err != nil {
+			return err
+		}
+	}
+
+	l.seqMu.Lock()
+	defer l.seqMu.Unlock()
+	return fn(lockedSender{l})
+}
+
+// lockedSender sends commands while the caller holds seqMu, see WithLock.
+type lockedSender struct{ l *Connection }
+
+func (s lockedSender) SendCommand(ctx context.Context, command Command) (CommandReply, error) {
+	return s.l.sendCommandRetry(ctx, command, s.l.enqueue)
+}
+
+// transmitterMask returns the SET_TRANSMITTERS mask for the given transmitter
+// numbers.
+func transmitterMask(channels []uint) (string, error) {
+	if len(channels) == 0 {
+		return "", errors.New("no transmitters given")
+	}
+
+	var mask uint32
+	for _, ch := range channels {
+		if ch < 1 || ch > 32 {
+			return "", fmt.Errorf("invalid transmitter %d, must be between 1 and 32", ch)
+		}
+		mask |= 1 << (ch - 1)
+	}
+
+	return strconv.FormatUint(uint64(mask), 10), nil
+}
+
+// GetTransmitters returns the transmitter mask last set with [SetTransmitters]
+// through this connection. lircd has no command to query its transmitters, so
+// if they were never set through this connection, the returned error matches
+// [errors.ErrUnsupported]. ctx is currently unused.
+func (l *Connection) GetTransmitters(ctx context.Context) (string, error) {
+	mask := l.lastTransmitters()
+	if mask == "" {
+		return "", fmt.Errorf("lircd cannot report its transmitters: %w", errors.ErrUnsupported)
+	}
+	return mask, nil
+}
+
+func (l *Connection) lastTransmitters() string {
+	l.transmittersMu.Lock()
+	defer l.transmittersMu.Unlock()
+	return l.transmitters
+}
+
+func (l *Connection) setTransmitters(mask string) {
+	l.transmittersMu.Lock()
+	defer l.transmittersMu.Unlock()
+	l.transmitters = mask
+}
@@ -0,0 +1,211 @@
+package lirc
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestSendOnceBlocking(t *testing.T) {
+	const frame = 100 * time.Millisecond
+
+	clock := newFakeClock()
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, []Option{withClock(clock)})
+	ctx := startTestConnection(t, conn)
+
+	done := make(chan error)
+	go func() { done <- conn.SendOnceBlocking(ctx, "remote", "KEY_POWER", 2, frame) }()
+
+	eventually(t, func() bool { return clock.HasTimer(3 * frame) }, "transmission wait")
+	assert.Equal(t, []string{"SEND_ONCE remote KEY_POWER 2"}, srv.received())
+
+	clock.Advance(3*frame - time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatal("returned before the transmission estimate:", err)
+	default:
+	}
+
+	clock.Advance(time.Millisecond)
+	assert.NoError(t, <-done, "returns after the transmission estimate")
+}
+
+func TestDefaultRepeats(t *testing.T) {
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, []Option{WithDefaultRepeats(3)})
+	ctx := startTestConnection(t, conn)
+
+	for _, command := range []Command{
+		SendOnce{RemoteControl: "tv", ButtonName: "KEY_POWER"},
+		SendOnce{RemoteControl: "tv", ButtonName: "KEY_POWER", Repeats: 1},
+	} {
+		_, err := conn.SendCommand(ctx, command)
+		assert.NoError(t, err, "send")
+	}
+
+	assert.Equal(t, []string{
+		"SEND_ONCE tv KEY_POWER 3",
+		"SEND_ONCE tv KEY_POWER 1",
+	}, srv.received(), "default is only used when repeats is unset")
+}
+
+func TestSendOnceVia(t *testing.T) {
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+
+	assert.NoError(t, conn.SendOnceVia(ctx, "tv", "KEY_POWER", 2), "nothing to restore")
+
+	_, err := conn.SendCommand(ctx, SetTransmitters{TransmitterMask: "1"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, conn.SendOnceVia(ctx, "tv", "KEY_POWER", 2, 3), "restores the previous mask")
+
+	assert.Equal(t, []string{
+		"SET_TRANSMITTERS 2",
+		"SEND_ONCE tv KEY_POWER",
+		"SET_TRANSMITTERS 1",
+		"SET_TRANSMITTERS 6",
+		"SEND_ONCE tv KEY_POWER",
+		"SET_TRANSMITTERS 1",
+	}, srv.received())
+
+	assert.Error(t, conn.SendOnceVia(ctx, "tv", "KEY_POWER"), "no transmitters")
+	assert.Error(t, conn.SendOnceVia(ctx, "tv", "KEY_POWER", 33), "transmitter out of range")
+}
+
+func TestGetTransmitters(t *testing.T) {
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+
+	_, err := conn.GetTransmitters(ctx)
+	assert.IsError(t, err, errors.ErrUnsupported, "transmitters were never set")
+
+	_, err = conn.SendCommand(ctx, SetTransmitters{TransmitterMask: "5"})
+	assert.NoError(t, err)
+
+	mask, err := conn.GetTransmitters(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "5", mask, "last mask set through the connection")
+}
+
+func TestSendMany(t *testing.T) {
+	srv := newMockServer(t, func(line string) []string {
+		if line == "SEND_ONCE tv KEY_MISSING" {
+			return mockReply(line, false, `unknown command: "KEY_MISSING"`)
+		}
+		return mockSuccess(line)
+	})
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+
+	assert.NoError(t, conn.SendMany(ctx, "tv", "KEY_1", "KEY_2", "KEY_3"))
+
+	err := conn.SendMany(ctx, "tv", "KEY_4", "KEY_MISSING", "KEY_5")
+	assert.IsError(t, err, ErrUnknownButton, "stops at the failing button")
+
+	assert.Equal(t, []string{
+		"SEND_ONCE tv KEY_1",
+		"SEND_ONCE tv KEY_2",
+		"SEND_ONCE tv KEY_3",
+		"SEND_ONCE tv KEY_4",
+		"SEND_ONCE tv KEY_MISSING",
+	}, srv.received(), "buttons are sent in order")
+}
+
+func TestTrySendCommand(t *testing.T) {
+	release := make(chan struct{})
+	srv := newMockServer(t, func(line string) []string {
+		if strings.HasPrefix(line, "SEND_ONCE") {
+			<-release
+		}
+		return mockSuccess(line)
+	})
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+	assert.NoError(t, conn.WaitConnected(ctx))
+
+	sent := make(chan error)
+	go func() {
+		_, err := conn.SendCommand(ctx, SendOnce{RemoteControl: "remote", ButtonName: "KEY_POWER"})
+		sent <- err
+	}()
+	eventually(t, func() bool { return len(srv.received()) == 1 }, "command in flight")
+
+	_, err := conn.TrySendCommand(Version{})
+	assert.IsError(t, err, ErrBusy, "command in flight")
+
+	close(release)
+	assert.NoError(t, <-sent)
+
+	eventually(t, func() bool {
+		_, err = conn.TrySendCommand(Version{})
+		return !errors.Is(err, ErrBusy)
+	}, "idle connection")
+	assert.NoError(t, err, "sent once idle")
+}
+
+func TestTrySendCommandIdle(t *testing.T) {
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+	assert.NoError(t, conn.WaitConnected(ctx))
+
+	for i := range 100 {
+		_, err := conn.TrySendCommand(Version{})
+		assert.NoError(t, err, "command %d on an idle connection", i)
+	}
+}
+
+func TestWithLock(t *testing.T) {
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+	assert.NoError(t, conn.WaitConnected(ctx))
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				_, err := conn.SendCommand(ctx, SendOnce{RemoteControl: "other", ButtonName: fmt.Sprint("KEY_", i)})
+				assert.NoError(t, err)
+			}
+		}()
+	}
+
+	locked := []string{"SEND_ONCE tv KEY_POWER", "SEND_ONCE amp KEY_POWER", "SEND_ONCE projector KEY_POWER"}
+	err := conn.WithLock(ctx, func(s Sender) error {
+		for _, command := range locked {
+			args := strings.Fields(command)
+			if _, err := s.SendCommand(ctx, SendOnce{RemoteControl: args[1], ButtonName: args[2]}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	close(stop)
+	wg.Wait()
+
+	received := srv.received()
+	start := slices.Index(received, locked[0])
+	assert.NotEqual(t, -1, start, "locked commands are sent")
+	assert.Equal(t, locked, received[start:start+len(locked)], "locked commands are contiguous")
+}
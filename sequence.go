@@ -0,0 +1,81 @@
+package lirc
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// WaitForSequence blocks until the buttons are pressed in order on a remote
+// control matching the remote pattern, the first and last of them at most
+// within apart, or until ctx is done, in which case it returns ctx's error.
+// Repeats of held buttons are ignored, and any other button pressed in between
+// restarts the sequence, as does taking too long. Sequences that start in the
+// middle of a failed attempt are still matched, such as 1 1 2 after 1 1 1 2.
+// Like [Connection.Subscribe], presses are only received while
+// [Connection.Events] is being consumed, and it fails with
+// [ErrTooManySubscribers] if there is no room left for another subscriber.
+func (l *Connection) WaitForSequence(ctx context.Context, remote string, buttons []string, within time.Duration) error {
+	if len(buttons) == 0 {
+		return nil
+	}
+
+	events, unsubscribe, err := l.TrySubscribeRemote(remote)
+	if err != nil {
+		return err
+	}
+	defer unsubscribe()
+
+	seq := newSequenceMatcher(buttons, within)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event := <-events:
+			if event.RepeatCount == 0 && seq.press(event.ButtonName, l.opts.clock.Now()) {
+				return nil
+			}
+		}
+	}
+}
+
+// sequenceMatcher matches a sequence of buttons against the last presses.
+type sequenceMatcher struct {
+	buttons []string
+	within  time.Duration
+	// recent holds the last presses, at most as many as there are buttons.
+	recent []sequencePress
+}
+
+type sequencePress struct {
+	button string
+	at     time.Time
+}
+
+func newSequenceMatcher(buttons []string, within time.Duration) *sequenceMatcher {
+	return &sequenceMatcher{
+		buttons: buttons,
+		within:  within,
+		recent:  make([]sequencePress, 0, len(buttons)),
+	}
+}
+
+// press records a press of button and returns whether it completes the
+// sequence. Only the last presses are compared, so a sequence starting in the
+// middle of a failed attempt is matched as well.
+func (m *sequenceMatcher) press(button string, at time.Time) bool {
+	if len(m.recent) == len(m.buttons) {
+		m.recent = slices.Delete(m.recent, 0, 1)
+	}
+	m.recent = append(m.recent, sequencePress{button, at})
+
+	if len(m.recent) < len(m.buttons) || at.Sub(m.recent[0].at) > m.within {
+		return false
+	}
+	for i, p := range m.recent {
+		if p.button != m.buttons[i] {
+			return false
+		}
+	}
+	return true
+}
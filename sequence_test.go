@@ -0,0 +1,80 @@
+package lirc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestSequenceMatcher(t *testing.T) {
+	tests := []struct {
+		name    string
+		presses []string
+		gap     time.Duration
+		matched bool
+	}{
+		{"match", []string{"KEY_1", "KEY_1", "KEY_2"}, 100 * time.Millisecond, true},
+		{"overlapping attempt", []string{"KEY_1", "KEY_1", "KEY_1", "KEY_2"}, 100 * time.Millisecond, true},
+		{"wrong button", []string{"KEY_1", "KEY_3", "KEY_1", "KEY_2"}, 100 * time.Millisecond, false},
+		{"retried after wrong button", []string{"KEY_1", "KEY_3", "KEY_1", "KEY_1", "KEY_2"}, 100 * time.Millisecond, true},
+		{"timeout", []string{"KEY_1", "KEY_1", "KEY_2"}, 600 * time.Millisecond, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := newSequenceMatcher([]string{"KEY_1", "KEY_1", "KEY_2"}, time.Second)
+			at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+			var matched bool
+			for i, button := range test.presses {
+				matched = m.press(button, at)
+				if matched && i < len(test.presses)-1 {
+					t.Fatalf("matched early at press %d", i)
+				}
+				at = at.Add(test.gap)
+			}
+			assert.Equal(t, test.matched, matched)
+		})
+	}
+}
+
+func TestWaitForSequence(t *testing.T) {
+	clock := newFakeClock()
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, []Option{withClock(clock)})
+	ctx := startTestConnection(t, conn)
+
+	waitCtx, cancel := context.WithCancel(ctx)
+	result := make(chan error, 1)
+	go func() {
+		result <- conn.WaitForSequence(waitCtx, "tv", []string{"KEY_1", "KEY_2"}, time.Second)
+	}()
+	eventually(t, func() bool { return subscribers(conn) == 1 }, "wait to subscribe")
+
+	for _, line := range []string{
+		"0000000000000001 00 KEY_1 amp", // other remote
+		"0000000000000001 00 KEY_1 tv",
+		"0000000000000001 01 KEY_1 tv", // repeat
+		"0000000000000002 00 KEY_2 tv",
+	} {
+		srv.broadcast(line)
+		<-conn.Events
+		clock.Advance(100 * time.Millisecond)
+	}
+	assert.NoError(t, <-result, "sequence is matched")
+
+	go func() {
+		result <- conn.WaitForSequence(waitCtx, "tv", []string{"KEY_1", "KEY_2"}, time.Second)
+	}()
+	eventually(t, func() bool { return subscribers(conn) == 1 }, "wait to subscribe")
+	cancel()
+	assert.IsError(t, <-result, context.Canceled, "waiting stops with ctx")
+}
+
+func subscribers(conn *Connection) int {
+	conn.subsMu.Lock()
+	defer conn.subsMu.Unlock()
+	return len(conn.subs)
+}
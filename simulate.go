@@ -0,0 +1,31 @@
+package lirc
+
+import (
+	"context"
+	"errors"
+)
+
+// simulateProbe is a Simulate command that lircd rejects as a malformed packet,
+// without broadcasting anything, once it checked that simulating is allowed.
+var simulateProbe = Simulate{Key: "0000000000000000", Data: "00"}
+
+// SupportsSimulate returns whether lircd accepts [Simulate] commands, which it
+// only does if it was started with --allow-simulate. It sends a malformed
+// Simulate command that lircd rejects without broadcasting anything, so no
+// client receives a button press.
+func (l *Connection) SupportsSimulate(ctx context.Context) (bool, error) {
+	_, err := l.SendCommand(ctx, simulateProbe)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, ErrSimulateDisabled) {
+		return false, nil
+	}
+
+	// Any other error from lircd comes after the check.
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		return true, nil
+	}
+	return false, err
+}
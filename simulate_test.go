@@ -0,0 +1,39 @@
+package lirc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestSupportsSimulate(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		supports bool
+	}{
+		{"disabled", "SIMULATE command is disabled", false},
+		{"not allowed", "SIMULATE not allowed", false},
+		{"allowed", "bad send packet", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := newMockServer(t, func(line string) []string {
+				return mockReply(line, false, test.message)
+			})
+			conn := newConnection(srv.dial, nil)
+			ctx := startTestConnection(t, conn)
+
+			supports, err := conn.SupportsSimulate(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, test.supports, supports)
+
+			// The probe must not be a valid packet, or lircd would broadcast it.
+			assert.Equal(t, 1, len(srv.received()))
+			_, err = ParseBroadcast(strings.TrimPrefix(srv.received()[0], "SIMULATE "))
+			assert.IsError(t, err, ErrMalformedBroadcast, "probe is rejected by lircd")
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package lirc
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnectionStats contains counters about a [Connection].
+type ConnectionStats struct {
+	// Events is the number of button presses received, including those
+	// dropped by [WithRepeatFilter] or [WithDedup].
+	Events uint64
+	// Commands is the number of commands written to lircd, including one
+	// whose write failed partway.
+	Commands uint64
+	// LastEvent is when the last button press was received, or the zero time
+	// if none was.
+	LastEvent time.Time
+	// LastCommand is when the last command was written to lircd, or the zero
+	// time if none was.
+	LastCommand time.Time
+	// Disconnected is the total time spent disconnected since the connection
+	// was first established, including the current disconnection, if any.
+	Disconnected time.Duration
+	// LastDisconnect is when the connection was last lost, or the zero time if
+	// it never was.
+	LastDisconnect time.Time
+	// RemoteRates is the number of button presses received per second from
+	// each remote control over about the last 10 seconds, which helps find
+	// remote controls that send phantom repeats. Remote controls that sent
+	// nothing in that time aren't included.
+	RemoteRates map[string]float64
+}
+
+// Event rates are counted in rateBuckets buckets of rateBucket each, which
+// make up a window sliding by rateBucket.
+const (
+	rateBucket  = time.Second
+	rateBuckets = 10
+)
+
+// eventRates counts the button presses of each remote control in the last
+// rateBuckets buckets. It is safe for concurrent use.
+type eventRates struct {
+	mu      sync.Mutex
+	start   time.Time // when the first press was counted
+	remotes map[string]*[rateBuckets]rateCount
+}
+
+// rateCount is the number of presses counted in a bucket.
+type rateCount struct {
+	bucket int64 // index of the bucket since start
+	count  uint64
+}
+
+func (r *eventRates) count(remote string, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.remotes == nil {
+		r.start = now
+		r.remotes = make(map[string]*[rateBuckets]rateCount)
+	}
+
+	counts := r.remotes[remote]
+	if counts == nil {
+		counts = new([rateBuckets]rateCount)
+		r.remotes[remote] = counts
+	}
+
+	bucket := int64(now.Sub(r.start) / rateBucket)
+	c := &counts[bucket%rateBuckets]
+	if c.bucket != bucket {
+		*c = rateCount{bucket: bucket}
+	}
+	c.count++
+}
+
+// rates returns the number of presses per second of each remote control in
+// the buckets up to now, and forgets remote controls that have none.
+func (r *eventRates) rates(now time.Time) map[string]float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.remotes) == 0 {
+		return nil
+	}
+
+	elapsed := now.Sub(r.start)
+	current := int64(elapsed / rateBucket)
+	// The current bucket is only partly over, and the window may be longer
+	// than the time since the first press. Short times are rounded up to a
+	// bucket so that a few presses don't make for a huge rate.
+	window := (rateBuckets-1)*rateBucket + elapsed%rateBucket
+	window = max(min(window, elapsed), rateBucket)
+
+	rates := make(map[string]float64, len(r.remotes))
+	for remote, counts := range r.remotes {
+		var total uint64
+		for _, c := range counts {
+			if c.bucket > current-rateBuckets && c.bucket <= current {
+				total += c.count
+			}
+		}
+		if total == 0 {
+			delete(r.remotes, remote)
+			continue
+		}
+		rates[remote] = float64(total) / window.Seconds()
+	}
+	return rates
+}
+
+// connectionStats holds the counters of ConnectionStats. It is safe for
+// concurrent use.
+type connectionStats struct {
+	events   atomic.Uint64
+	commands atomic.Uint64
+	// The times are kept as they are rather than as Unix nanoseconds so that
+	// they keep their monotonic clock reading.
+	lastEvent   atomic.Pointer[time.Time]
+	lastCommand atomic.Pointer[time.Time]
+	rates       eventRates
+}
+
+// Stats returns a snapshot of the connection's counters. They are kept across
+// reconnections.
+func (l *Connection) Stats() ConnectionStats {
+	stats := ConnectionStats{
+		Events:      l.stats.events.Load(),
+		Commands:    l.stats.commands.Load(),
+		LastEvent:   loadTime(&l.stats.lastEvent),
+		LastCommand: loadTime(&l.stats.lastCommand),
+		RemoteRates: l.stats.rates.rates(l.opts.clock.Now()),
+	}
+
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+
+	stats.Disconnected = l.disconnectedTotal
+	stats.LastDisconnect = l.lastDisconnect
+	if !l.connected && !l.lastDisconnect.IsZero() {
+		stats.Disconnected += l.opts.clock.Now().Sub(l.lastDisconnect)
+	}
+	return stats
+}
+
+func (s *connectionStats) countEvent(event ButtonPress, now time.Time) {
+	s.events.Add(1)
+	s.lastEvent.Store(&now)
+	s.rates.count(event.RemoteControlName, now)
+}
+
+func (s *connectionStats) countCommand(now time.Time) {
+	s.commands.Add(1)
+	s.lastCommand.Store(&now)
+}
+
+func loadTime(p *atomic.Pointer[time.Time]) time.Time {
+	if t := p.Load(); t != nil {
+		return *t
+	}
+	return time.Time{}
+}
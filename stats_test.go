@@ -0,0 +1,115 @@
+package lirc
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/neilotoole/slogt"
+)
+
+func TestStats(t *testing.T) {
+	clock := newFakeClock()
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, []Option{withClock(clock)})
+	ctx := startTestConnection(t, conn)
+
+	assert.Equal(t, ConnectionStats{}, conn.Stats(), "nothing happened yet")
+
+	_, err := conn.SendCommand(ctx, Version{})
+	assert.NoError(t, err)
+	commandTime := clock.Now()
+
+	clock.Advance(time.Minute)
+	srv.broadcast("00000000e0e040bf 00 KEY_POWER remote")
+	<-conn.Events
+	srv.broadcast("00000000e0e040bf 01 KEY_POWER remote")
+	<-conn.Events
+
+	stats := conn.Stats()
+	assert.Equal(t, uint64(2), stats.Events, "events")
+	assert.Equal(t, uint64(1), stats.Commands, "commands")
+	assert.True(t, stats.LastEvent.Equal(commandTime.Add(time.Minute)), "last event time")
+	assert.True(t, stats.LastCommand.Equal(commandTime), "last command time")
+}
+
+func TestStatsRemoteRates(t *testing.T) {
+	clock := newFakeClock()
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, []Option{withClock(clock)})
+	startTestConnection(t, conn)
+
+	press := func(remote string) {
+		srv.broadcast("00000000e0e040bf 00 KEY_POWER " + remote)
+		<-conn.Events
+	}
+
+	// 5 presses per second from tv and 1 from amp, for 10 seconds.
+	for i := range 50 {
+		press("tv")
+		if i%5 == 0 {
+			press("amp")
+		}
+		clock.Advance(200 * time.Millisecond)
+	}
+
+	rates := conn.Stats().RemoteRates
+	assert.Equal(t, 2, len(rates), "rate of each remote")
+	assert.True(t, math.Abs(rates["tv"]-5) < 0.5, "tv rate is %v", rates["tv"])
+	assert.True(t, math.Abs(rates["amp"]-1) < 0.2, "amp rate is %v", rates["amp"])
+
+	clock.Advance(5 * time.Second)
+	rates = conn.Stats().RemoteRates
+	assert.True(t, rates["tv"] < 5, "old presses slide out of the window")
+
+	clock.Advance(10 * time.Second)
+	assert.Zero(t, conn.Stats().RemoteRates, "quiet remotes are forgotten")
+}
+
+func TestStatsMonotonic(t *testing.T) {
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, nil)
+	ctx := startTestConnection(t, conn)
+
+	_, err := conn.SendCommand(ctx, Version{})
+	assert.NoError(t, err)
+	srv.broadcast("00000000e0e040bf 00 KEY_POWER remote")
+	<-conn.Events
+
+	// Without their monotonic reading, durations computed from the times
+	// would be off by however much the system time was stepped.
+	stats := conn.Stats()
+	assert.True(t, hasMonotonic(stats.LastEvent), "last event time is monotonic")
+	assert.True(t, hasMonotonic(stats.LastCommand), "last command time is monotonic")
+}
+
+func TestStatsDisconnected(t *testing.T) {
+	clock := newFakeClock()
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, []Option{
+		withClock(clock),
+		WithAutoStart(context.Background(), slogt.New(t)),
+	})
+	t.Cleanup(func() { conn.Close() })
+
+	_, err := conn.SendCommand(context.Background(), Version{})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), conn.Stats().Disconnected, "never disconnected")
+
+	srv.hangup()
+	eventually(t, func() bool { return !conn.Connected() }, "disconnect")
+	disconnectedAt := clock.Now()
+
+	clock.Advance(time.Minute)
+	stats := conn.Stats()
+	assert.Equal(t, time.Minute, stats.Disconnected, "ongoing disconnection is counted")
+	assert.True(t, stats.LastDisconnect.Equal(disconnectedAt), "last disconnect time")
+
+	_, err = conn.SendCommand(context.Background(), Version{})
+	assert.NoError(t, err, "reconnect")
+
+	clock.Advance(time.Hour)
+	assert.Equal(t, time.Minute, conn.Stats().Disconnected, "time connected is not counted")
+}
@@ -0,0 +1,171 @@
+package lirc
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// subscriberBuffer is the number of unread events kept for each subscriber.
+// Any more are dropped.
+const subscriberBuffer = 16
+
+// ErrTooManySubscribers is returned by [Connection.TrySubscribe] when the
+// subscriber would take the buffers of all subscribers past the limit set by
+// [WithSubscriberBufferLimit].
+var ErrTooManySubscribers = errors.New("lirc: too many subscribers")
+
+// subscriber receives a copy of the events delivered by a connection.
+type subscriber struct {
+	ch chan ButtonPress
+	// wants returns whether the subscriber receives the event. If nil, it
+	// receives every event.
+	wants func(ButtonPress) bool
+}
+
+// Subscribe returns a channel that receives a copy of every button press
+// received by the connection, in addition to its usual delivery, and a
+// function that cancels the subscription and closes the channel. The channel
+// is buffered, and events are dropped while it's full so that a slow
+// subscriber never holds up the connection. Each subscriber receives events in
+// the order lircd sent them, like [Connection.Events], although it may miss some
+// while its channel is full. Events are only received while
+// [Connection.Events] (or [Connection.ConnEvents]) is being consumed.
+//
+// If [WithSubscriberBufferLimit] is used and there is no room left for the
+// buffer, the channel is closed right away; use [Connection.TrySubscribe] to
+// tell this apart.
+func (l *Connection) Subscribe() (<-chan ButtonPress, func()) {
+	return mustSubscribe(l.subscribe(nil))
+}
+
+// TrySubscribe is like Subscribe, but fails with [ErrTooManySubscribers] if
+// there is no room left for the buffer of the subscriber.
+func (l *Connection) TrySubscribe() (<-chan ButtonPress, func(), error) {
+	return l.subscribe(nil)
+}
+
+// SubscribeRemote is like Subscribe, but the channel only receives the button
+// presses of the remote controls whose name matches the pattern, which is
+// matched like the remote control patterns of [RouteEvents]. Other presses
+// don't take up room in the channel.
+func (l *Connection) SubscribeRemote(pattern string) (<-chan ButtonPress, func()) {
+	return mustSubscribe(l.TrySubscribeRemote(pattern))
+}
+
+// TrySubscribeRemote is like SubscribeRemote, but fails with
+// [ErrTooManySubscribers] like [Connection.TrySubscribe].
+func (l *Connection) TrySubscribeRemote(pattern string) (<-chan ButtonPress, func(), error) {
+	return l.subscribe(func(event ButtonPress) bool {
+		matched, _ := filepath.Match(pattern, event.RemoteControlName)
+		return matched
+	})
+}
+
+// mustSubscribe returns a closed channel if subscribing failed.
+func mustSubscribe(ch <-chan ButtonPress, unsubscribe func(), err error) (<-chan ButtonPress, func()) {
+	if err != nil {
+		closed := make(chan ButtonPress)
+		close(closed)
+		return closed, func() {}
+	}
+	return ch, unsubscribe
+}
+
+func (l *Connection) subscribe(wants func(ButtonPress) bool) (<-chan ButtonPress, func(), error) {
+	l.subsMu.Lock()
+	buffer := subscriberBuffer
+	if limit := l.opts.subscriberBufferLimit; limit > 0 && l.subsBuffered+buffer > limit {
+		if !l.opts.shrinkSubscribers {
+			l.subsMu.Unlock()
+			return nil, nil, ErrTooManySubscribers
+		}
+		buffer = max(limit-l.subsBuffered, 0)
+	}
+
+	sub := &subscriber{
+		ch:    make(chan ButtonPress, buffer),
+		wants: wants,
+	}
+	if l.subs == nil {
+		l.subs = make(map[*subscriber]struct{})
+	}
+	l.subs[sub] = struct{}{}
+	l.subsBuffered += buffer
+	l.subsMu.Unlock()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			l.subsMu.Lock()
+			defer l.subsMu.Unlock()
+
+			delete(l.subs, sub)
+			l.subsBuffered -= cap(sub.ch)
+			close(sub.ch)
+		})
+	}, nil
+}
+
+// publish sends event to every subscriber that has room for it. It is called
+// by the goroutine reading from lircd for one event at a time, which keeps
+// every subscriber's events in order.
+func (l *Connection) publish(event ButtonPress) {
+	l.subsMu.Lock()
+	defer l.subsMu.Unlock()
+
+	for sub := range l.subs {
+		if sub.wants != nil && !sub.wants(event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+		}
+	}
+}
+
+// SendAndCapture sends the command, then waits for the given duration after
+// the reply and returns the button presses received since the command was
+// sent. This is useful for tools that learn or discover buttons. If ctx is done
+// while waiting, the reply and the presses received so far are returned along
+// with ctx's error. The command isn't sent if subscribing fails with
+// [ErrTooManySubscribers].
+func (l *Connection) SendAndCapture(ctx context.Context, command Command, within time.Duration) (CommandReply, []ButtonPress, error) {
+	events, unsubscribe, err := l.TrySubscribe()
+	if err != nil {
+		return CommandReply{}, nil, err
+	}
+	defer unsubscribe()
+
+	reply, err := l.SendCommand(ctx, command)
+	if err != nil {
+		return reply, nil, err
+	}
+
+	window := l.opts.clock.NewTimer(within)
+	defer window.Stop()
+
+	var presses []ButtonPress
+	for {
+		select {
+		case <-ctx.Done():
+			return reply, presses, ctx.Err()
+		case <-window.C():
+			// Keep the presses that arrived before the window ended but
+			// weren't picked up yet.
+			for {
+				select {
+				case event := <-events:
+					presses = append(presses, event)
+				default:
+					return reply, presses, nil
+				}
+			}
+		case event := <-events:
+			presses = append(presses, event)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package lirc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestSubscribe(t *testing.T) {
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, nil)
+	startTestConnection(t, conn)
+
+	events, unsubscribe := conn.Subscribe()
+
+	srv.broadcast("00000000e0e040bf 00 KEY_POWER remote")
+	assert.Equal(t, "KEY_POWER", (<-conn.Events).ButtonName, "event is delivered as usual")
+	assert.Equal(t, "KEY_POWER", (<-events).ButtonName, "subscriber receives a copy")
+
+	unsubscribe()
+	unsubscribe()
+	_, ok := <-events
+	assert.False(t, ok, "channel is closed once unsubscribed")
+}
+
+func TestSubscribeRemote(t *testing.T) {
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, nil)
+	startTestConnection(t, conn)
+
+	tv, unsubscribeTV := conn.SubscribeRemote("tv")
+	defer unsubscribeTV()
+	amps, unsubscribeAmps := conn.SubscribeRemote("amp*")
+	defer unsubscribeAmps()
+
+	go srv.broadcast(
+		"00000000e0e040bf 00 KEY_POWER tv",
+		"00000000e0e040bf 00 KEY_POWER amp-living",
+		"00000000e0e040bf 00 KEY_POWER projector",
+		"00000000e0e040bf 00 KEY_MUTE tv")
+	for range 4 {
+		<-conn.Events
+	}
+
+	assert.Equal(t, "KEY_POWER", (<-tv).ButtonName, "exact remote")
+	assert.Equal(t, "KEY_MUTE", (<-tv).ButtonName, "exact remote")
+	assert.Equal(t, 0, len(tv), "other remotes are filtered")
+	assert.Equal(t, "amp-living", (<-amps).RemoteControlName, "remote pattern")
+	assert.Equal(t, 0, len(amps), "other remotes are filtered")
+}
+
+func TestSubscribeOrder(t *testing.T) {
+	const burst = 200
+
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, nil)
+	startTestConnection(t, conn)
+
+	var subs []<-chan ButtonPress
+	var unsubscribes []func()
+	for range 4 {
+		events, unsubscribe := conn.Subscribe()
+		subs = append(subs, events)
+		unsubscribes = append(unsubscribes, unsubscribe)
+	}
+
+	// Repeat counts number the events, so each receiver must see them
+	// increase.
+	lines := make([]string, burst)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("00000000e0e040bf %02x KEY_POWER remote", i)
+	}
+	go srv.broadcast(lines...)
+
+	var wg sync.WaitGroup
+	for i, events := range subs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			last := -1
+			for event := range events {
+				if int(event.RepeatCount) <= last {
+					t.Errorf("subscriber %d received %d after %d", i, event.RepeatCount, last)
+				}
+				last = int(event.RepeatCount)
+			}
+		}()
+	}
+
+	for i := range burst {
+		assert.Equal(t, uint(i), (<-conn.Events).RepeatCount, "events are in order")
+	}
+
+	// Every event has been published, so the subscribers are done once they
+	// read what is left in their channel.
+	for _, unsubscribe := range unsubscribes {
+		unsubscribe()
+	}
+	wg.Wait()
+}
+
+func TestSendAndCapture(t *testing.T) {
+	const within = time.Second
+
+	clock := newFakeClock()
+	srv := newMockServer(t, mockSuccess)
+	conn := newConnection(srv.dial, []Option{withClock(clock)})
+	ctx := startTestConnection(t, conn)
+
+	type result struct {
+		reply   CommandReply
+		presses []ButtonPress
+		err     error
+	}
+	done := make(chan result)
+	go func() {
+		reply, presses, err := conn.SendAndCapture(ctx, Version{}, within)
+		done <- result{reply, presses, err}
+	}()
+
+	eventually(t, func() bool { return clock.HasTimer(within) }, "capture window")
+
+	go srv.broadcast(
+		"00000000e0e040bf 00 KEY_POWER remote",
+		"00000000e0e040bf 01 KEY_POWER remote")
+	<-conn.Events
+	<-conn.Events
+
+	clock.Advance(within)
+	r := <-done
+	assert.NoError(t, r.err)
+	assert.Equal(t, "VERSION", r.reply.Command, "reply")
+	assert.Equal(t, 2, len(r.presses), "presses within the window are captured")
+	assert.Equal(t, uint(1), r.presses[1].RepeatCount, "presses are in order")
+}
+
+func TestSubscriberBufferLimit(t *testing.T) {
+	t.Run("reject", func(t *testing.T) {
+		conn := newConnection(nil, []Option{WithSubscriberBufferLimit(2*subscriberBuffer + 8)})
+
+		_, unsubscribe1, err := conn.TrySubscribe()
+		assert.NoError(t, err)
+		_, _, err = conn.TrySubscribeRemote("tv")
+		assert.NoError(t, err)
+
+		_, _, err = conn.TrySubscribe()
+		assert.IsError(t, err, ErrTooManySubscribers)
+
+		events, _ := conn.Subscribe()
+		_, ok := <-events
+		assert.False(t, ok, "rejected subscription is closed")
+
+		_, _, err = conn.SendAndCapture(context.Background(), Version{}, time.Second)
+		assert.IsError(t, err, ErrTooManySubscribers)
+
+		unsubscribe1()
+		_, _, err = conn.TrySubscribe()
+		assert.NoError(t, err, "unsubscribing makes room")
+	})
+
+	t.Run("shrink", func(t *testing.T) {
+		conn := newConnection(nil, []Option{
+			WithSubscriberBufferLimit(2*subscriberBuffer + 8),
+			WithShrinkingSubscribers(),
+		})
+
+		var caps []int
+		var unsubscribes []func()
+		for range 4 {
+			events, unsubscribe, err := conn.TrySubscribe()
+			assert.NoError(t, err)
+			caps = append(caps, cap(events))
+			unsubscribes = append(unsubscribes, unsubscribe)
+		}
+		assert.Equal(t, []int{subscriberBuffer, subscriberBuffer, 8, 0}, caps)
+
+		unsubscribes[0]()
+		events, _ := conn.Subscribe()
+		assert.Equal(t, subscriberBuffer, cap(events), "unsubscribing makes room")
+	})
+}
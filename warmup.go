@@ -0,0 +1,108 @@
+package lirc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"time"
+)
+
+// warmupRetry is how long to wait before retrying a failed warmup.
+const warmupRetry = 30 * time.Second
+
+// ServerVersion returns the lircd version fetched by [WithWarmup]. It returns
+// false if the version hasn't been fetched.
+func (l *Connection) ServerVersion() (string, bool) {
+	l.warmupMu.Lock()
+	defer l.warmupMu.Unlock()
+	return l.version, l.version != ""
+}
+
+// Catalog returns the buttons of every remote control fetched by
+// [WithWarmup], keyed by remote control name. It returns false if the catalog
+// hasn't been fetched. If the buttons of some remote controls couldn't be
+// listed, the catalog only has the others until a retry of the warmup lists
+// them.
+func (l *Connection) Catalog() (map[string][]Button, bool) {
+	l.warmupMu.Lock()
+	defer l.warmupMu.Unlock()
+	return maps.Clone(l.catalog), l.catalog != nil
+}
+
+// warmup fetches the server version and catalog. If that fails, it keeps
+// retrying in the background until ctx is done.
+func (l *Connection) warmup(ctx context.Context, logger *slog.Logger) (retry func()) {
+	err := l.fetchWarmup(ctx)
+	if err == nil {
+		return nil
+	}
+
+	logger.Warn(
+		"cannot warm up lircd connection, retrying later",
+		"err", err)
+
+	return func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-l.opts.clock.After(warmupRetry):
+			}
+
+			err := l.fetchWarmup(ctx)
+			if err == nil {
+				return
+			}
+
+			logger.Warn(
+				"cannot warm up lircd connection, retrying later",
+				"err", err)
+		}
+	}
+}
+
+func (l *Connection) fetchWarmup(ctx context.Context) error {
+	s := warmupSender{l}
+
+	reply, err := s.SendCommand(ctx, Version{})
+	if err != nil {
+		return fmt.Errorf("cannot get version: %w", err)
+	}
+	if len(reply.Data) == 0 {
+		return fmt.Errorf("cannot get version: empty reply")
+	}
+
+	// The buttons of some remote controls may be missing from the catalog,
+	// which is still kept then.
+	catalog, catalogErr := allButtons(ctx, s)
+	if catalog == nil {
+		return fmt.Errorf("cannot get catalog: %w", catalogErr)
+	}
+
+	capabilities, err := CapabilitiesOf(reply.Data[0])
+
+	l.warmupMu.Lock()
+	l.version = reply.Data[0]
+	l.catalog = catalog
+	l.capabilities = capabilities
+	l.capabilitiesOK = err == nil
+	l.warmupMu.Unlock()
+
+	if catalogErr != nil {
+		return fmt.Errorf("cannot get full catalog: %w", catalogErr)
+	}
+	return nil
+}
+
+// warmupSender sends the commands of the warmup. The warmup runs before the
+// session counts as connected, so the commands can't wait for the connection
+// to be established like SendCommand does with WithAutoStart. They don't wait
+// for seqMu either, since its holder may be waiting for the warmup to be done
+// to start the connection; VERSION and LIST don't change anything in lircd,
+// so they can come in the middle of a sequence.
+type warmupSender struct{ l *Connection }
+
+func (s warmupSender) SendCommand(ctx context.Context, command Command) (CommandReply, error) {
+	return s.l.sendCommandRetry(ctx, command, s.l.enqueue)
+}
@@ -0,0 +1,132 @@
+package lirc
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/neilotoole/slogt"
+)
+
+func TestWarmup(t *testing.T) {
+	catalog := mockCatalog([]string{"tv"}, map[string][]string{
+		"tv": {"00000000000040bf KEY_POWER"},
+	})
+
+	srv := newMockServer(t, func(line string) []string {
+		if line == "VERSION" {
+			return mockReply("VERSION", true, "0.10.2")
+		}
+		return catalog(line)
+	})
+	conn := newConnection(srv.dial, []Option{WithWarmup()})
+
+	_, ok := conn.ServerVersion()
+	assert.False(t, ok, "no version before connecting")
+
+	ctx := startTestConnection(t, conn)
+	assert.NoError(t, conn.WaitConnected(ctx), "wait for connection")
+
+	version, ok := conn.ServerVersion()
+	assert.True(t, ok, "version is cached once connected")
+	assert.Equal(t, "0.10.2", version)
+
+	capabilities, ok := conn.Capabilities()
+	assert.True(t, ok, "capabilities are derived from the version")
+	assert.Equal(t, Capabilities{SupportsDrvOption: true, SupportsInputLog: true}, capabilities)
+
+	buttons, ok := conn.Catalog()
+	assert.True(t, ok, "catalog is cached once connected")
+	assert.Equal(t, map[string][]Button{"tv": {{0x40bf, "KEY_POWER"}}}, buttons)
+}
+
+func TestWarmupRetry(t *testing.T) {
+	clock := newFakeClock()
+
+	fail := true
+	srv := newMockServer(t, func(line string) []string {
+		if fail {
+			fail = false
+			return mockReply(strings.Fields(line)[0], false)
+		}
+		if line == "VERSION" {
+			return mockReply("VERSION", true, "0.10.2")
+		}
+		return mockReply("LIST", true)
+	})
+	conn := newConnection(srv.dial, []Option{WithWarmup(), withClock(clock)})
+	ctx := startTestConnection(t, conn)
+
+	assert.NoError(t, conn.WaitConnected(ctx), "failed warmup doesn't block connecting")
+	_, ok := conn.ServerVersion()
+	assert.False(t, ok, "warmup failed")
+
+	eventually(t, func() bool { return clock.HasTimer(warmupRetry) }, "warmup retry")
+	clock.Advance(warmupRetry)
+	eventually(t, func() bool { _, ok := conn.ServerVersion(); return ok }, "warmup retry to succeed")
+
+}
+
+func TestWarmupPartialCatalog(t *testing.T) {
+	clock := newFakeClock()
+
+	catalog := mockCatalog([]string{"tv", "amp"}, map[string][]string{
+		"tv":  {"00000000000040bf KEY_POWER"},
+		"amp": {"000000000000e01f KEY_VOLUMEUP"},
+	})
+	fail := true
+	srv := newMockServer(t, func(line string) []string {
+		switch {
+		case line == "VERSION":
+			return mockReply("VERSION", true, "0.10.2")
+		case line == "LIST amp" && fail:
+			fail = false
+			return mockReply("LIST", false)
+		}
+		return catalog(line)
+	})
+	conn := newConnection(srv.dial, []Option{WithWarmup(), withClock(clock)})
+	ctx := startTestConnection(t, conn)
+	assert.NoError(t, conn.WaitConnected(ctx), "wait for connection")
+
+	buttons, ok := conn.Catalog()
+	assert.True(t, ok, "partial catalog is kept")
+	assert.Equal(t, map[string][]Button{"tv": {{0x40bf, "KEY_POWER"}}}, buttons)
+
+	eventually(t, func() bool { return clock.HasTimer(warmupRetry) }, "warmup retry")
+	clock.Advance(warmupRetry)
+	eventually(t, func() bool { buttons, _ := conn.Catalog(); return len(buttons) == 2 }, "warmup retry to complete the catalog")
+}
+
+func TestWarmupAutoStart(t *testing.T) {
+	catalog := mockCatalog([]string{"tv"}, map[string][]string{
+		"tv": {"00000000000040bf KEY_POWER"},
+	})
+
+	srv := newMockServer(t, func(line string) []string {
+		if line == "VERSION" {
+			return mockReply("VERSION", true, "0.10.2")
+		}
+		return catalog(line)
+	})
+	conn := newConnection(srv.dial, []Option{
+		WithAutoStart(context.Background(), slogt.New(t)),
+		WithWarmup(),
+	})
+	t.Cleanup(func() { conn.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := conn.SendCommand(ctx, Version{})
+	assert.NoError(t, err, "first command starts the connection")
+
+	version, ok := conn.ServerVersion()
+	assert.True(t, ok, "warmup is done before the first command is sent")
+	assert.Equal(t, "0.10.2", version)
+
+	_, ok = conn.Catalog()
+	assert.True(t, ok, "catalog is cached")
+}